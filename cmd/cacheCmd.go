@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// metaExt is the extension of the metadata file kept next to every cached dump.
+const metaExt = ".meta.json"
+
+// staleLeftoverAge is how long a leftover, such as a '.part' file, has to be left
+// untouched before a plain prune removes it. A newer one may belong to a download
+// another upctl is still running.
+const staleLeftoverAge = time.Hour
+
+// dumpMeta is kept next to a cached dump in '<dump>.meta.json' and records where
+// the dump came from and what it should look like on disk.
+type dumpMeta struct {
+	Source    string    `json:"source"`
+	Version   string    `json:"version,omitempty"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+func readDumpMeta(path string) (dumpMeta, error) {
+	var meta dumpMeta
+	data, err := os.ReadFile(path + metaExt)
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+func writeDumpMeta(path string, meta dumpMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+metaExt, data, 0600)
+}
+
+// verifyDump checks that a cached dump still has the size and SHA-256 recorded
+// when it was fetched.
+func verifyDump(path string, meta dumpMeta) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != meta.Size {
+		return fmt.Errorf("size is %d bytes instead of %d", info.Size(), meta.Size)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != meta.SHA256 {
+		return fmt.Errorf("sha256 is %s instead of %s", sum, meta.SHA256)
+	}
+	return nil
+}
+
+// dumpCacheDir returns the directory fetched dumps are cached in, ~/.upctl/cache/dumps.
+func dumpCacheDir() (string, error) {
+	home, err := upctlHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "cache", "dumps"), nil
+}
+
+// cachedDumpPath returns the cache file of a target's dump from source,
+// <cache>/<project>/<database>/<file>, creating its directory if needed.
+func cachedDumpPath(target DatabaseTarget, source dumpSource) (string, error) {
+	if err := checkProjectName(); err != nil {
+		return "", err
+	}
+	cacheDir, err := dumpCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cacheDir, projectName(), target.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating cache directory '%s': %s", dir, err)
+	}
+	return filepath.Join(dir, source.fileName()), nil
+}
+
+// CacheEntry is a file in the dump cache.
+type CacheEntry struct {
+	Project  string
+	Database string
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	// Meta is nil for leftovers such as '.part' files of interrupted downloads.
+	Meta *dumpMeta
+}
+
+// listCache returns the files in the dump cache, sorted by path.
+func listCache() ([]CacheEntry, error) {
+	cacheDir, err := dumpCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	var entries []CacheEntry
+	err = filepath.WalkDir(cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == cacheDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, metaExt) {
+			return nil
+		}
+		rel, err := filepath.Rel(cacheDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := CacheEntry{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+		if len(parts) == 3 {
+			entry.Project, entry.Database = parts[0], parts[1]
+		}
+		if meta, err := readDumpMeta(path); err == nil {
+			entry.Meta = &meta
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump cache '%s': %w", cacheDir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// inUseDumps returns the cache files the databases of the current project read
+// their dumps from.
+func inUseDumps() (map[string]bool, error) {
+	targets, err := loadDatabaseTargets()
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		source, err := dumpSourceFor(target, nil)
+		if err != nil || source == nil {
+			continue
+		}
+		path, err := cachedDumpPath(target, source)
+		if err != nil {
+			return nil, err
+		}
+		inUse[path] = true
+	}
+	return inUse, nil
+}
+
+// RunCacheLs prints the cached dumps.
+func RunCacheLs(cmd *cobra.Command, args []string) error {
+	entries, err := listCache()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("The dump cache is empty")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tDATABASE\tFILE\tSIZE\tFETCHED\tSOURCE")
+	var total int64
+	for _, entry := range entries {
+		fetched, source := "-", "(incomplete)"
+		if entry.Meta != nil {
+			fetched = entry.Meta.FetchedAt.Local().Format("2006-01-02 15:04:05")
+			source = entry.Meta.Source
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Project, entry.Database, filepath.Base(entry.Path), formatBytes(entry.Size), fetched, source)
+		total += entry.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Total: %s\n", formatBytes(total))
+	return nil
+}
+
+// RunCachePrune removes cached dumps. Without flags it removes leftovers of
+// interrupted downloads that have not been touched for staleLeftoverAge and the
+// dumps of the current project that its databases no longer use; --older-than also
+// removes dumps fetched and leftovers last written before then, and --all empties
+// the cache.
+func RunCachePrune(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	olderThan, _ := cmd.Flags().GetDuration("older-than")
+	if all && olderThan > 0 {
+		return usageError("cannot use --older-than together with --all")
+	}
+	if olderThan < 0 {
+		return usageError("--older-than must be positive")
+	}
+
+	entries, err := listCache()
+	if err != nil {
+		return err
+	}
+	inUse, err := inUseDumps()
+	if err != nil {
+		return err
+	}
+
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		var prune bool
+		switch {
+		case all:
+			prune = true
+		case entry.Meta == nil:
+			age := time.Since(entry.ModTime)
+			prune = age > staleLeftoverAge || (olderThan > 0 && age > olderThan)
+		default:
+			prune = (entry.Project == projectName() && !inUse[entry.Path]) ||
+				(olderThan > 0 && time.Since(entry.Meta.FetchedAt) > olderThan)
+		}
+		if !prune {
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil {
+			return fmt.Errorf("error removing '%s': %w", entry.Path, err)
+		}
+		os.Remove(entry.Path + metaExt)
+		fmt.Printf("Removed %s (%s)\n", entry.Path, formatBytes(entry.Size))
+		removed++
+		freed += entry.Size
+	}
+	fmt.Printf("Removed %d cached dump(s), freed %s\n", removed, formatBytes(freed))
+	return nil
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache [command]",
+	Short: "Manage the cache of downloaded database dumps",
+	Long:  `Lists and prunes the database dumps downloaded by import-db, which are kept in ~/.upctl/cache/dumps/<project>/<database> together with their source, size and SHA-256.`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached database dumps",
+	Args:  cobra.NoArgs,
+	RunE:  RunCacheLs,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached database dumps",
+	Long:  `Removes leftovers of interrupted downloads that have not been written to for an hour, so downloads still running are left alone, and the dumps of the current project that its databases no longer use. --older-than also removes dumps downloaded longer ago than the given duration, in any project; --all empties the cache.`,
+	Args:  cobra.NoArgs,
+	RunE:  RunCachePrune,
+}
+
+func init() {
+	cachePruneCmd.Flags().Bool("all", false, "Remove every cached dump")
+	cachePruneCmd.Flags().Duration("older-than", 0, "Also remove dumps downloaded longer ago than this, e.g. 720h")
+
+	cacheCmd.AddCommand(cacheLsCmd, cachePruneCmd)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// writeCachedDump puts a dump with metadata into the dump cache.
+func writeCachedDump(t *testing.T, project, database, file, source string, fetchedAt time.Time) string {
+	t.Helper()
+	cacheDir, err := dumpCacheDir()
+	if err != nil {
+		t.Fatalf("dumpCacheDir() returned an error: %v", err)
+	}
+	dir := filepath.Join(cacheDir, project, database)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("Failed to create %s: %v", dir, err)
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, []byte("-- dump\n"), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if source != "" {
+		if err := writeDumpMeta(path, dumpMeta{Source: source, Size: 8, FetchedAt: fetchedAt}); err != nil {
+			t.Fatalf("Failed to write metadata: %v", err)
+		}
+	}
+	return path
+}
+
+func TestRunCachePrune(t *testing.T) {
+	setup(t)
+	defer teardown()
+	viper.Set("databases", []map[string]interface{}{
+		{"name": "app", "service": "mysql", "source": map[string]interface{}{"url": "s3://backups/app-v2.sql"}},
+	})
+
+	now := time.Now()
+	inUse := writeCachedDump(t, projectName(), "app", "app-v2.sql", "s3://backups/app-v2.sql", now)
+	replaced := writeCachedDump(t, projectName(), "app", "app-v1.sql", "s3://backups/app-v1.sql", now)
+	partial := writeCachedDump(t, projectName(), "app", "app-v2.sql.part", "", now)
+	stale := writeCachedDump(t, projectName(), "app", "app-v1.sql.part", "", now)
+	if err := os.Chtimes(stale, now.Add(-2*time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("Failed to age %s: %v", stale, err)
+	}
+	otherRecent := writeCachedDump(t, "other", "db", "db.sql", "https://example.com/db.sql", now)
+	otherOld := writeCachedDump(t, "other", "db", "old.sql", "https://example.com/old.sql", now.Add(-48*time.Hour))
+
+	entries, err := listCache()
+	if err != nil {
+		t.Fatalf("listCache() returned an error: %v", err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("Expected 6 cache entries, got %+v", entries)
+	}
+
+	pruneCmd := func(args ...string) error {
+		c := &cobra.Command{Use: "prune", RunE: RunCachePrune}
+		c.Flags().Bool("all", false, "")
+		c.Flags().Duration("older-than", 0, "")
+		c.SetArgs(args)
+		return c.Execute()
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	if err := pruneCmd(); err != nil {
+		t.Fatalf("cache prune failed: %v", err)
+	}
+	if exists(replaced) || exists(replaced+metaExt) || exists(stale) {
+		t.Errorf("Expected the unused dump and the stale .part file to be removed")
+	}
+	if !exists(partial) {
+		t.Errorf("Expected a .part file that may still be downloading to be kept")
+	}
+	if !exists(inUse) || !exists(otherRecent) || !exists(otherOld) {
+		t.Errorf("Expected the dump in use and other projects' dumps to be kept")
+	}
+
+	if err := pruneCmd("--older-than", "24h"); err != nil {
+		t.Fatalf("cache prune --older-than failed: %v", err)
+	}
+	if exists(otherOld) || !exists(otherRecent) || !exists(inUse) {
+		t.Errorf("Expected only the dump older than a day to be removed")
+	}
+
+	if err := pruneCmd("--all", "--older-than", "1h"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for --all with --older-than, got %v", err)
+	}
+	if err := pruneCmd("--all"); err != nil {
+		t.Fatalf("cache prune --all failed: %v", err)
+	}
+	if entries, _ := listCache(); len(entries) != 0 {
+		t.Errorf("Expected an empty cache, got %+v", entries)
+	}
+}
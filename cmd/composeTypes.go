@@ -0,0 +1,633 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeService is the typed model of a single entry under 'services' in upctl.yaml.
+// Keys that are not modelled explicitly are kept in Extras so that a service
+// round-trips to the rendered compose file without losing anything.
+type ComposeService struct {
+	Image         string                 `yaml:"image,omitempty"`
+	Build         *ServiceBuild          `yaml:"build,omitempty"`
+	ContainerName string                 `yaml:"container_name,omitempty"`
+	Command       StringOrList           `yaml:"command,omitempty"`
+	Entrypoint    StringOrList           `yaml:"entrypoint,omitempty"`
+	Ports         []ServicePort          `yaml:"ports,omitempty"`
+	Volumes       []ServiceVolume        `yaml:"volumes,omitempty"`
+	Environment   KeyValues              `yaml:"environment,omitempty"`
+	EnvFile       StringOrList           `yaml:"env_file,omitempty"`
+	DependsOn     DependsOn              `yaml:"depends_on,omitempty"`
+	Healthcheck   *Healthcheck           `yaml:"healthcheck,omitempty"`
+	Labels        KeyValues              `yaml:"labels,omitempty"`
+	Profiles      []string               `yaml:"profiles,omitempty"`
+	Networks      ServiceNetworks        `yaml:"networks,omitempty"`
+	Restart       string                 `yaml:"restart,omitempty"`
+	Extras        map[string]interface{} `yaml:",inline"`
+}
+
+// ServiceBuild is the 'build' section of a service, written either as a context path or as a mapping.
+type ServiceBuild struct {
+	Context    string                 `yaml:"context,omitempty"`
+	Dockerfile string                 `yaml:"dockerfile,omitempty"`
+	Target     string                 `yaml:"target,omitempty"`
+	Args       KeyValues              `yaml:"args,omitempty"`
+	Extras     map[string]interface{} `yaml:",inline"`
+
+	short bool
+}
+
+type serviceBuildFields ServiceBuild
+
+// UnmarshalYAML accepts both 'build: ./dir' and the long mapping syntax.
+func (b *ServiceBuild) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*b = ServiceBuild{Context: node.Value, short: true}
+		return nil
+	}
+	var fields serviceBuildFields
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	*b = ServiceBuild(fields)
+	return nil
+}
+
+// MarshalYAML writes the build section back in the syntax it was read from.
+func (b ServiceBuild) MarshalYAML() (interface{}, error) {
+	if b.short {
+		return b.Context, nil
+	}
+	return serviceBuildFields(b), nil
+}
+
+// StringOrList is a value such as 'command' or 'entrypoint' that compose accepts
+// either as a single string or as a list of strings.
+type StringOrList struct {
+	Values []string
+
+	single bool
+}
+
+// UnmarshalYAML accepts a scalar or a sequence of scalars.
+func (s *StringOrList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*s = StringOrList{Values: []string{node.Value}, single: true}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*s = StringOrList{Values: values}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a string or a list of strings", node.Line)
+}
+
+// MarshalYAML writes the value back in the syntax it was read from.
+func (s StringOrList) MarshalYAML() (interface{}, error) {
+	if s.single && len(s.Values) == 1 {
+		return s.Values[0], nil
+	}
+	return s.Values, nil
+}
+
+// IsZero reports whether the value is empty, so that omitempty drops it.
+func (s StringOrList) IsZero() bool {
+	return len(s.Values) == 0
+}
+
+// KeyValues holds an ordered set of KEY=value pairs such as 'environment' or 'labels'.
+// Compose accepts them as a list of "KEY=value" strings or as a mapping; the
+// syntax that was read is preserved when marshaling. A nil value means the key
+// was given without a value (e.g. "- DEBUG"), which compose resolves from the shell.
+type KeyValues struct {
+	Keys   []string
+	Values map[string]*string
+
+	list bool
+}
+
+// Get returns the value of key and whether the key is present.
+func (kv KeyValues) Get(key string) (string, bool) {
+	value, ok := kv.Values[key]
+	if !ok || value == nil {
+		return "", ok
+	}
+	return *value, true
+}
+
+// Set adds or replaces key, keeping the position of an existing key.
+func (kv *KeyValues) Set(key string, value string) {
+	if kv.Values == nil {
+		kv.Values = make(map[string]*string)
+	}
+	if _, exists := kv.Values[key]; !exists {
+		kv.Keys = append(kv.Keys, key)
+	}
+	kv.Values[key] = &value
+}
+
+// Delete removes key if it is present.
+func (kv *KeyValues) Delete(key string) {
+	if _, exists := kv.Values[key]; !exists {
+		return
+	}
+	delete(kv.Values, key)
+	for i, k := range kv.Keys {
+		if k == key {
+			kv.Keys = append(kv.Keys[:i], kv.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// IsZero reports whether there are no keys, so that omitempty drops the value.
+func (kv KeyValues) IsZero() bool {
+	return len(kv.Keys) == 0
+}
+
+func (kv *KeyValues) add(key string, value *string) {
+	if kv.Values == nil {
+		kv.Values = make(map[string]*string)
+	}
+	if _, exists := kv.Values[key]; !exists {
+		kv.Keys = append(kv.Keys, key)
+	}
+	kv.Values[key] = value
+}
+
+// UnmarshalYAML accepts a list of "KEY=value" strings or a mapping.
+func (kv *KeyValues) UnmarshalYAML(node *yaml.Node) error {
+	*kv = KeyValues{}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		kv.list = true
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: expected a KEY=value string", item.Line)
+			}
+			key, value, hasValue := strings.Cut(item.Value, "=")
+			if hasValue {
+				kv.add(key, &value)
+			} else {
+				kv.add(key, nil)
+			}
+		}
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if valueNode.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: value of '%s' must be a string, number or boolean", valueNode.Line, keyNode.Value)
+			}
+			if valueNode.Tag == "!!null" {
+				kv.add(keyNode.Value, nil)
+				continue
+			}
+			value := valueNode.Value
+			kv.add(keyNode.Value, &value)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a list of KEY=value strings or a mapping", node.Line)
+}
+
+// MarshalYAML writes the pairs back in the syntax they were read from.
+func (kv KeyValues) MarshalYAML() (interface{}, error) {
+	if kv.list {
+		items := make([]string, 0, len(kv.Keys))
+		for _, key := range kv.Keys {
+			if value := kv.Values[key]; value != nil {
+				items = append(items, key+"="+*value)
+			} else {
+				items = append(items, key)
+			}
+		}
+		return items, nil
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range kv.Keys {
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		if value := kv.Values[key]; value != nil {
+			valueNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: *value}
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+	}
+	return node, nil
+}
+
+// ServicePort is one entry of a service's 'ports' list, parsed from either the
+// short syntax ("[HOST_IP:][HOST:]CONTAINER[/PROTOCOL]") or the long mapping syntax.
+type ServicePort struct {
+	Name        string
+	HostIP      string
+	Published   string
+	Target      string
+	Protocol    string
+	Mode        string
+	AppProtocol string
+
+	short *yaml.Node
+}
+
+type servicePortLong struct {
+	Name        string `yaml:"name,omitempty"`
+	Target      string `yaml:"target"`
+	HostIP      string `yaml:"host_ip,omitempty"`
+	Published   string `yaml:"published,omitempty"`
+	Protocol    string `yaml:"protocol,omitempty"`
+	AppProtocol string `yaml:"app_protocol,omitempty"`
+	Mode        string `yaml:"mode,omitempty"`
+}
+
+// parseShortPort splits a short syntax port entry into its parts.
+func parseShortPort(entry string) (ServicePort, error) {
+	var port ServicePort
+	spec := entry
+	if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+		port.Protocol = spec[idx+1:]
+		spec = spec[:idx]
+	}
+	// An IPv6 host address is written in brackets: "[::1]:8080:80"
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]")
+		if end < 0 || end+1 >= len(spec) || spec[end+1] != ':' {
+			return ServicePort{}, fmt.Errorf("invalid port format '%s'", entry)
+		}
+		port.HostIP = spec[1:end]
+		spec = spec[end+2:]
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 {
+			return ServicePort{}, fmt.Errorf("invalid port format '%s'", entry)
+		}
+		port.Published, port.Target = parts[0], parts[1]
+		return port, nil
+	}
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		port.Target = parts[0]
+	case 2:
+		port.Published, port.Target = parts[0], parts[1]
+	case 3:
+		port.HostIP, port.Published, port.Target = parts[0], parts[1], parts[2]
+	default:
+		return ServicePort{}, fmt.Errorf("invalid port format '%s'", entry)
+	}
+	if port.Target == "" {
+		return ServicePort{}, fmt.Errorf("invalid port format '%s'", entry)
+	}
+	return port, nil
+}
+
+// UnmarshalYAML accepts the short string/number syntax or the long mapping syntax.
+func (p *ServicePort) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		port, err := parseShortPort(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", node.Line, err)
+		}
+		port.short = &yaml.Node{Kind: yaml.ScalarNode, Tag: node.Tag, Style: node.Style, Value: node.Value}
+		*p = port
+		return nil
+	case yaml.MappingNode:
+		var long servicePortLong
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		*p = ServicePort{
+			Name:        long.Name,
+			HostIP:      long.HostIP,
+			Published:   long.Published,
+			Target:      long.Target,
+			Protocol:    long.Protocol,
+			Mode:        long.Mode,
+			AppProtocol: long.AppProtocol,
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a port string or mapping", node.Line)
+}
+
+// MarshalYAML writes the port back in the syntax it was read from.
+func (p ServicePort) MarshalYAML() (interface{}, error) {
+	if p.short != nil {
+		return p.short, nil
+	}
+	long := servicePortLong{
+		Name:        p.Name,
+		Target:      p.Target,
+		HostIP:      p.HostIP,
+		Published:   p.Published,
+		Protocol:    p.Protocol,
+		AppProtocol: p.AppProtocol,
+		Mode:        p.Mode,
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(long); err != nil {
+		return nil, err
+	}
+	// Compose wants the container port as a number.
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "target" {
+			if _, err := strconv.Atoi(p.Target); err == nil {
+				node.Content[i+1].Tag = "!!int"
+				node.Content[i+1].Style = 0
+			}
+		}
+	}
+	return node, nil
+}
+
+// ServiceVolume is one entry of a service's 'volumes' list, parsed from either the
+// short syntax ("SOURCE:TARGET[:MODE]") or the long mapping syntax.
+type ServiceVolume struct {
+	Type     string                 `yaml:"type,omitempty"`
+	Source   string                 `yaml:"source,omitempty"`
+	Target   string                 `yaml:"target,omitempty"`
+	ReadOnly bool                   `yaml:"read_only,omitempty"`
+	Extras   map[string]interface{} `yaml:",inline"`
+
+	// Mode holds the access mode suffix of the short syntax, e.g. "ro" or "rw,z".
+	Mode string `yaml:"-"`
+
+	short string
+}
+
+type serviceVolumeFields ServiceVolume
+
+// UnmarshalYAML accepts the short string syntax or the long mapping syntax.
+func (v *ServiceVolume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		volume := ServiceVolume{short: node.Value}
+		parts := strings.Split(node.Value, ":")
+		// Windows paths ("C:\data:/data") contain an extra colon after the drive letter.
+		if len(parts) > 2 && len(parts[0]) == 1 {
+			parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+		}
+		switch len(parts) {
+		case 1:
+			volume.Type = "volume"
+			volume.Target = parts[0]
+		case 2, 3:
+			volume.Source, volume.Target = parts[0], parts[1]
+			if len(parts) == 3 {
+				volume.Mode = parts[2]
+				volume.ReadOnly = contains(strings.Split(parts[2], ","), "ro")
+			}
+			volume.Type = "volume"
+			if strings.HasPrefix(volume.Source, ".") || strings.HasPrefix(volume.Source, "/") || strings.HasPrefix(volume.Source, "~") || strings.Contains(volume.Source, "\\") {
+				volume.Type = "bind"
+			}
+		default:
+			return fmt.Errorf("line %d: invalid volume format '%s'", node.Line, node.Value)
+		}
+		*v = volume
+		return nil
+	}
+	var fields serviceVolumeFields
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	*v = ServiceVolume(fields)
+	return nil
+}
+
+// MarshalYAML writes the volume back in the syntax it was read from.
+func (v ServiceVolume) MarshalYAML() (interface{}, error) {
+	if v.short != "" {
+		return v.short, nil
+	}
+	return serviceVolumeFields(v), nil
+}
+
+// ServiceDependency is one entry of a service's 'depends_on'.
+type ServiceDependency struct {
+	Service   string `yaml:"-"`
+	Condition string `yaml:"condition,omitempty"`
+	Restart   bool   `yaml:"restart,omitempty"`
+	Required  *bool  `yaml:"required,omitempty"`
+}
+
+// Condition values compose understands in the long 'depends_on' syntax.
+const (
+	DependencyStarted      = "service_started"
+	DependencyHealthy      = "service_healthy"
+	DependencyCompleted    = "service_completed_successfully"
+	defaultDependencyState = DependencyStarted
+)
+
+// DependsOn is a service's 'depends_on', written as a list of names or as a
+// mapping of names to conditions.
+type DependsOn struct {
+	Entries []ServiceDependency
+
+	list bool
+}
+
+// Names returns the names of the services depended on, in declaration order.
+func (d DependsOn) Names() []string {
+	names := make([]string, 0, len(d.Entries))
+	for _, entry := range d.Entries {
+		names = append(names, entry.Service)
+	}
+	return names
+}
+
+// IsZero reports whether there are no dependencies, so that omitempty drops the value.
+func (d DependsOn) IsZero() bool {
+	return len(d.Entries) == 0
+}
+
+// UnmarshalYAML accepts a list of service names or a mapping with conditions.
+func (d *DependsOn) UnmarshalYAML(node *yaml.Node) error {
+	*d = DependsOn{}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		d.list = true
+		for _, name := range names {
+			d.Entries = append(d.Entries, ServiceDependency{Service: name, Condition: defaultDependencyState})
+		}
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var entry ServiceDependency
+			if err := node.Content[i+1].Decode(&entry); err != nil {
+				return err
+			}
+			entry.Service = node.Content[i].Value
+			d.Entries = append(d.Entries, entry)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a list of services or a mapping", node.Line)
+}
+
+// MarshalYAML writes the dependencies back in the syntax they were read from.
+func (d DependsOn) MarshalYAML() (interface{}, error) {
+	if d.list {
+		return d.Names(), nil
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, entry := range d.Entries {
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(entry); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: entry.Service}, valueNode)
+	}
+	return node, nil
+}
+
+// Healthcheck is a service's 'healthcheck' section.
+type Healthcheck struct {
+	Test          StringOrList           `yaml:"test,omitempty"`
+	Interval      string                 `yaml:"interval,omitempty"`
+	Timeout       string                 `yaml:"timeout,omitempty"`
+	StartPeriod   string                 `yaml:"start_period,omitempty"`
+	StartInterval string                 `yaml:"start_interval,omitempty"`
+	Retries       *int                   `yaml:"retries,omitempty"`
+	Disable       bool                   `yaml:"disable,omitempty"`
+	Extras        map[string]interface{} `yaml:",inline"`
+}
+
+// ServiceNetwork is one network a service is attached to.
+type ServiceNetwork struct {
+	Name        string                 `yaml:"-"`
+	Aliases     []string               `yaml:"aliases,omitempty"`
+	IPv4Address string                 `yaml:"ipv4_address,omitempty"`
+	IPv6Address string                 `yaml:"ipv6_address,omitempty"`
+	Extras      map[string]interface{} `yaml:",inline"`
+}
+
+// ServiceNetworks is a service's 'networks', written as a list of names or as a
+// mapping of names to attachment options.
+type ServiceNetworks struct {
+	Entries []ServiceNetwork
+
+	list bool
+}
+
+// IsZero reports whether there are no networks, so that omitempty drops the value.
+func (n ServiceNetworks) IsZero() bool {
+	return len(n.Entries) == 0
+}
+
+// UnmarshalYAML accepts a list of network names or a mapping.
+func (n *ServiceNetworks) UnmarshalYAML(node *yaml.Node) error {
+	*n = ServiceNetworks{}
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		n.list = true
+		for _, name := range names {
+			n.Entries = append(n.Entries, ServiceNetwork{Name: name})
+		}
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var entry ServiceNetwork
+			if node.Content[i+1].Tag != "!!null" {
+				if err := node.Content[i+1].Decode(&entry); err != nil {
+					return err
+				}
+			}
+			entry.Name = node.Content[i].Value
+			n.Entries = append(n.Entries, entry)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: expected a list of networks or a mapping", node.Line)
+}
+
+// MarshalYAML writes the networks back in the syntax they were read from.
+func (n ServiceNetworks) MarshalYAML() (interface{}, error) {
+	if n.list {
+		names := make([]string, 0, len(n.Entries))
+		for _, entry := range n.Entries {
+			names = append(names, entry.Name)
+		}
+		return names, nil
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, entry := range n.Entries {
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		if len(entry.Aliases) > 0 || entry.IPv4Address != "" || entry.IPv6Address != "" || len(entry.Extras) > 0 {
+			valueNode = &yaml.Node{}
+			if err := valueNode.Encode(entry); err != nil {
+				return nil, err
+			}
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: entry.Name}, valueNode)
+	}
+	return node, nil
+}
+
+// rawSection holds a configuration section that must keep the case of its keys.
+// viper lower-cases the keys of every mapping it reads, which would turn
+// MYSQL_ROOT_PASSWORD into mysql_root_password; it leaves other types alone.
+type rawSection struct {
+	value interface{}
+}
+
+// servicesConfig returns the raw 'services' value: the one readConfig kept out of
+// viper's key folding, or whatever was set in viper directly.
+func servicesConfig() interface{} {
+	raw := viper.Get("services")
+	if section, ok := raw.(rawSection); ok {
+		return section.value
+	}
+	return raw
+}
+
+// decodeComposeServices converts the raw 'services' value into typed services.
+func decodeComposeServices(raw interface{}) (map[string]ComposeService, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("'services' must be a mapping of service names to definitions, got %T", raw)
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var services map[string]ComposeService
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// loadComposeConfig reads the services, volumes and networks from the loaded upctl.yaml.
+func loadComposeConfig() (DockerComposeConfig, error) {
+	var cfg DockerComposeConfig
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return cfg, configError(err, "error loading docker compose config")
+	}
+	services, err := decodeComposeServices(servicesConfig())
+	if err != nil {
+		return cfg, configError(err, "error parsing services")
+	}
+	cfg.Services = services
+	if cfg.Services == nil {
+		cfg.Services = make(map[string]ComposeService)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const typedServicesYAML = `
+web:
+  image: nginx:latest
+  build:
+    context: ./web
+    args:
+      VERSION: "1.2"
+  command: nginx -g 'daemon off;'
+  ports:
+    - "127.0.0.1:8080:80"
+    - 9000
+    - target: 443
+      published: "8443"
+      protocol: tcp
+  volumes:
+    - ./html:/usr/share/nginx/html:ro
+    - type: volume
+      source: cache
+      target: /cache
+  environment:
+    - TZ=UTC
+    - DEBUG
+  depends_on:
+    db:
+      condition: service_healthy
+  healthcheck:
+    test: ["CMD", "curl", "-f", "http://localhost"]
+    interval: 10s
+    retries: 3
+  labels:
+    service: web
+  profiles: [frontend]
+  networks:
+    backend:
+      aliases: [www]
+  stop_grace_period: 30s
+db:
+  image: mysql:8.0
+  environment:
+    MYSQL_DATABASE: db
+    MYSQL_PORT: 3306
+  depends_on:
+    - cache
+  networks:
+    - backend
+`
+
+func TestComposeService_Decode(t *testing.T) {
+	var services map[string]ComposeService
+	if err := yaml.Unmarshal([]byte(typedServicesYAML), &services); err != nil {
+		t.Fatalf("Failed to decode services: %v", err)
+	}
+
+	web := services["web"]
+	if web.Build == nil || web.Build.Context != "./web" {
+		t.Errorf("Expected build context './web', got %+v", web.Build)
+	}
+	if v, _ := web.Build.Args.Get("VERSION"); v != "1.2" {
+		t.Errorf("Expected build arg VERSION=1.2, got '%s'", v)
+	}
+	if len(web.Ports) != 3 {
+		t.Fatalf("Expected 3 ports, got %d", len(web.Ports))
+	}
+	if p := web.Ports[0]; p.HostIP != "127.0.0.1" || p.Published != "8080" || p.Target != "80" {
+		t.Errorf("Unexpected short port parse: %+v", p)
+	}
+	if p := web.Ports[1]; p.Published != "" || p.Target != "9000" {
+		t.Errorf("Unexpected numeric port parse: %+v", p)
+	}
+	if p := web.Ports[2]; p.Published != "8443" || p.Target != "443" || p.Protocol != "tcp" {
+		t.Errorf("Unexpected long port parse: %+v", p)
+	}
+	if v := web.Volumes[0]; v.Type != "bind" || v.Source != "./html" || !v.ReadOnly {
+		t.Errorf("Unexpected short volume parse: %+v", v)
+	}
+	if v := web.Volumes[1]; v.Type != "volume" || v.Source != "cache" || v.Target != "/cache" {
+		t.Errorf("Unexpected long volume parse: %+v", v)
+	}
+	if v, ok := web.Environment.Get("TZ"); !ok || v != "UTC" {
+		t.Errorf("Expected TZ=UTC, got '%s' (present: %v)", v, ok)
+	}
+	if _, ok := web.Environment.Values["DEBUG"]; !ok || web.Environment.Values["DEBUG"] != nil {
+		t.Errorf("Expected DEBUG to be present without a value")
+	}
+	if len(web.DependsOn.Entries) != 1 || web.DependsOn.Entries[0].Service != "db" || web.DependsOn.Entries[0].Condition != DependencyHealthy {
+		t.Errorf("Unexpected depends_on parse: %+v", web.DependsOn)
+	}
+	if web.Healthcheck == nil || web.Healthcheck.Retries == nil || *web.Healthcheck.Retries != 3 || len(web.Healthcheck.Test.Values) != 4 {
+		t.Errorf("Unexpected healthcheck parse: %+v", web.Healthcheck)
+	}
+	if len(web.Networks.Entries) != 1 || web.Networks.Entries[0].Aliases[0] != "www" {
+		t.Errorf("Unexpected networks parse: %+v", web.Networks)
+	}
+	if web.Extras["stop_grace_period"] != "30s" {
+		t.Errorf("Expected unknown key stop_grace_period to be kept, got %v", web.Extras)
+	}
+
+	db := services["db"]
+	if v, _ := db.Environment.Get("MYSQL_PORT"); v != "3306" {
+		t.Errorf("Expected MYSQL_PORT=3306, got '%s'", v)
+	}
+	if names := db.DependsOn.Names(); len(names) != 1 || names[0] != "cache" {
+		t.Errorf("Expected depends_on [cache], got %v", names)
+	}
+}
+
+func TestComposeService_RoundTrip(t *testing.T) {
+	var services map[string]ComposeService
+	if err := yaml.Unmarshal([]byte(typedServicesYAML), &services); err != nil {
+		t.Fatalf("Failed to decode services: %v", err)
+	}
+	out, err := yaml.Marshal(services)
+	if err != nil {
+		t.Fatalf("Failed to marshal services: %v", err)
+	}
+
+	var original, roundTripped map[string]interface{}
+	if err := yaml.Unmarshal([]byte(typedServicesYAML), &original); err != nil {
+		t.Fatalf("Failed to decode original YAML: %v", err)
+	}
+	if err := yaml.Unmarshal(out, &roundTripped); err != nil {
+		t.Fatalf("Failed to decode marshaled YAML: %v", err)
+	}
+
+	// Compare through a canonical YAML encoding; scalars that were numbers in a
+	// KEY=value mapping are written as strings, which compose treats the same.
+	original["db"].(map[string]interface{})["environment"].(map[string]interface{})["MYSQL_PORT"] = "3306"
+	want, _ := yaml.Marshal(original)
+	got, _ := yaml.Marshal(roundTripped)
+	if string(want) != string(got) {
+		t.Errorf("Round trip changed the services.\nWant:\n%s\nGot:\n%s", want, got)
+	}
+	if !strings.Contains(string(out), `"127.0.0.1:8080:80"`) {
+		t.Errorf("Expected short port syntax to be preserved, got:\n%s", out)
+	}
+}
+
+func TestDecodeComposeServices_NotAMap(t *testing.T) {
+	if _, err := decodeComposeServices("not a map"); err == nil {
+		t.Errorf("Expected an error for a non-mapping 'services' value")
+	}
+}
+
+func TestLoadComposeConfig_KeepsKeyCase(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	chdir(t, t.TempDir())
+	viper.Reset()
+	defer viper.Reset()
+	writeConfigFile(t, "upctl.yaml", `
+services:
+  MySQL:
+    image: mysql:8.0
+    environment:
+      MYSQL_ROOT_PASSWORD: root
+    labels:
+      com.example.Team: Core
+  api:
+    image: api:1.0
+    environment:
+      - LOG_LEVEL=info
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	mysql, ok := cfg.Services["MySQL"]
+	if !ok {
+		t.Fatalf("Expected service 'MySQL', got %v", cfg.Services)
+	}
+	if value, ok := mysql.Environment.Get("MYSQL_ROOT_PASSWORD"); !ok || value != "root" {
+		t.Errorf("Expected MYSQL_ROOT_PASSWORD=root, got %v", mysql.Environment.Keys)
+	}
+	if _, ok := mysql.Labels.Get("com.example.Team"); !ok {
+		t.Errorf("Expected label com.example.Team, got %v", mysql.Labels.Keys)
+	}
+	if _, ok := cfg.Services["api"].Environment.Get("LOG_LEVEL"); !ok {
+		t.Errorf("Expected LOG_LEVEL, got %v", cfg.Services["api"].Environment.Keys)
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal the compose config: %v", err)
+	}
+	for _, want := range []string{"MySQL:", "MYSQL_ROOT_PASSWORD: root", "com.example.Team: Core", "- LOG_LEVEL=info"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in the rendered services, got:\n%s", want, data)
+		}
+	}
+}
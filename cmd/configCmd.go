@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
 
 	"github.com/spf13/cobra"
 )
@@ -17,74 +15,52 @@ var configCmd = &cobra.Command{
 	Short: "Execute a configuration command",
 	Long: `Execute a configuration command. 
 
-Valid commands are: docker
+Valid commands are: repo, docker [registry...]
 
 Example: upctl config repo
 
 repo: Configures the helm repositories for the local development environment
 repositories are defined in the config.yaml file.
 
-docker: Configures the ECR image pull secrets for the local development environment
+docker: Logs Docker into the registries in docker_config, or only the named ones.
+With --kubernetes it also creates the image pull secret docker_config.name in every
+namespace in docker_config.namespaces and adds it to their default service accounts.
+With named registries the other registries already in the secret are kept.
 `,
 	Args: cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		progress.Start()
 		defer progress.Stop()
 		// check for subcommand
 		if args[0] == "docker" || args[0] == "d" {
-			configDocker()
-		} else {
-			fmt.Println("Please provide a valid configuration command")
-			fmt.Println("Valid commands are: docker")
-			os.Exit(1)
+			if kubernetes, _ := cmd.Flags().GetBool("kubernetes"); kubernetes {
+				return configDockerKubernetes(args[1:])
+			}
+			return configDocker(args[1:]...)
+		} else if args[0] == "repo" || args[0] == "r" {
+			return RunHelmRepoConfig()
 		}
+		return usageError("'%s' is not a valid configuration command, valid commands are: repo, docker", args[0])
 	},
 }
 
-// configDocker configures Docker authentication, potentially using ECR/Teleport.
-func configDocker() {
-	var password string
-
-	if dockerConfig.UseTeleport {
+// configDocker logs Docker into the named registries from docker_config, or into
+// all of them without names.
+func configDocker(names ...string) error {
+	registries, err := selectRegistries(names)
+	if err != nil {
+		return err
+	}
+	for _, reg := range registries {
 		progress.Restart()
-		//lookup the teleport client path
-		path, err := exec.LookPath("tsh")
-		if err != nil {
-			fmt.Println("Error finding tsh:", err)
-			progress.Stop()
-			os.Exit(1)
-		}
-
-		fmt.Printf("Authenticating with AWS App: %s...\n", dockerConfig.AWSApp)
-		if err := ExecuteCommand(path, "apps", "login", dockerConfig.AWSApp, "--aws-role", teleportConfig.AWSRole); err != nil {
-			fmt.Println("Error authenticating with AWS:", err)
-			progress.Stop()
-			os.Exit(2)
-		}
-
-		// Execute the tsh aws ecr login command
-		password, err = tshAwsEcrLogin()
-		if err != nil {
-			fmt.Println(err)
-			progress.Stop()
-			os.Exit(1)
+		if _, err := loginRegistry(reg); err != nil {
+			return err
 		}
-	} else {
-		// get the password from the user
-		password = dockerConfig.Password
 	}
-
-	// Configure local Docker authentication
-	fmt.Println("Configuring Docker authentication...")
-	authCmd := fmt.Sprintf("docker login -u %s -p %s %s",
-		dockerConfig.Username, password, dockerConfig.Registry)
-
-	// Run the docker login command
-	if err := ExecuteCommand("sh", "-c", authCmd); err != nil {
-		fmt.Println("Error configuring Docker authentication:", err)
-		progress.Stop()
-		os.Exit(1)
-	}
-
 	fmt.Println("Docker authentication configured successfully")
+	return nil
+}
+
+func init() {
+	configCmd.Flags().Bool("kubernetes", false, "With docker: also create the image pull secret in the docker_config namespaces")
 }
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Tags that change how a value is merged into the layers below it.
+const (
+	// resetTag deletes the key from the layers below: 'DEBUG: !reset null'.
+	resetTag = "!reset"
+	// overrideTag replaces the value of the layers below instead of merging into it.
+	overrideTag = "!override"
+)
+
+// Placeholders for tagged values while the layers are merged. They can't collide
+// with real configuration because YAML can't hold NUL characters.
+const (
+	resetMarker    = "\x00reset"
+	overrideMarker = "\x00override"
+)
+
+// projectConfigNames are the names of the project configuration file, looked up in
+// the working directory in this order.
+var projectConfigNames = []string{"upctl.yaml", ".upctl.yaml"}
+
+// errNoConfigFile is returned by readConfig when none of the layers exist.
+var errNoConfigFile = errors.New("no config file found")
+
+// configFiles are the files the configuration was read from, lowest precedence first.
+var configFiles []string
+
+// overrideConfigPath returns the personal override file of a project file:
+// upctl.yaml is overridden by upctl.override.yaml next to it.
+func overrideConfigPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".override" + ext
+}
+
+// configLayerFiles returns the configuration files that exist, lowest precedence
+// first: the defaults in $HOME/.upctl.yaml, the project file (explicit, or else
+// upctl.yaml or .upctl.yaml in the working directory) and the personal override
+// file next to the project file.
+func configLayerFiles(explicit string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, path)
+		}
+	}
+	exists := func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && !info.IsDir()
+	}
+
+	project := explicit
+	if project != "" {
+		if _, err := os.Stat(project); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range projectConfigNames {
+			if exists(name) {
+				project = name
+				break
+			}
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		if defaults := filepath.Join(home, ".upctl.yaml"); exists(defaults) {
+			add(defaults)
+		}
+	}
+	if project != "" {
+		// A project file that is the home file keeps its place as the defaults layer.
+		add(project)
+		if override := overrideConfigPath(project); exists(override) {
+			add(override)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoConfigFile
+	}
+	return files, nil
+}
+
+// readConfigLayer reads a configuration file, replacing values tagged !reset or
+// !override with markers that mergeConfig understands.
+func readConfigLayer(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing '%s': %w", path, err)
+	}
+	markTaggedNodes(&doc, make(map[*yaml.Node]bool))
+	layer := make(map[string]interface{})
+	if err := doc.Decode(&layer); err != nil {
+		return nil, fmt.Errorf("error parsing '%s': %w", path, err)
+	}
+	return layer, nil
+}
+
+// markTaggedNodes rewrites nodes tagged !reset into the reset marker and nodes
+// tagged !override into a single entry mapping under the override marker.
+func markTaggedNodes(node *yaml.Node, visited map[*yaml.Node]bool) {
+	if node == nil || visited[node] {
+		return
+	}
+	visited[node] = true
+	for _, child := range node.Content {
+		markTaggedNodes(child, visited)
+	}
+	switch node.Tag {
+	case resetTag:
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: resetMarker}
+	case overrideTag:
+		value := *node
+		value.Tag = ""
+		*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: overrideMarker},
+			&value,
+		}}
+	}
+}
+
+// mergeConfig merges layer into base. Mappings are merged key by key, so a layer
+// only needs the keys it changes; lists and scalars replace the value below.
+func mergeConfig(base, layer map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(layer))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range layer {
+		if value == resetMarker {
+			delete(merged, key)
+			continue
+		}
+		if inner, ok := overriddenValue(value); ok {
+			merged[key] = inner
+			continue
+		}
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		layerMap, layerIsMap := value.(map[string]interface{})
+		if baseIsMap && layerIsMap {
+			merged[key] = mergeConfig(baseMap, layerMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// overriddenValue returns the value wrapped by an !override tag.
+func overriddenValue(value interface{}) (interface{}, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	inner, ok := m[overrideMarker]
+	return inner, ok
+}
+
+// stripMarkers removes the markers left where there was nothing to reset or
+// override, such as tags in the lowest layer.
+func stripMarkers(value interface{}) interface{} {
+	if inner, ok := overriddenValue(value); ok {
+		return stripMarkers(inner)
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == resetMarker {
+				delete(v, key)
+				continue
+			}
+			v[key] = stripMarkers(item)
+		}
+	case []interface{}:
+		kept := v[:0]
+		for _, item := range v {
+			if item != resetMarker {
+				kept = append(kept, stripMarkers(item))
+			}
+		}
+		return kept
+	}
+	return value
+}
+
+// keyValueFields are the service fields that hold KEY=value pairs, written either as
+// a list of KEY=value strings or as a mapping.
+var keyValueFields = [][]string{{"environment"}, {"labels"}, {"build", "args"}}
+
+// normalizeKeyValues turns the KEY=value fields of the services in both base and
+// layer into mappings wherever both set them and either uses the list form, so that
+// they are merged key by key like Docker Compose does rather than replaced.
+func normalizeKeyValues(base, layer map[string]interface{}) {
+	baseServices, _ := base["services"].(map[string]interface{})
+	layerServices, _ := layer["services"].(map[string]interface{})
+	for name, value := range layerServices {
+		baseService, _ := baseServices[name].(map[string]interface{})
+		layerService, _ := value.(map[string]interface{})
+		for _, field := range keyValueFields {
+			baseParent, layerParent := baseService, layerService
+			for _, key := range field[:len(field)-1] {
+				baseParent, _ = baseParent[key].(map[string]interface{})
+				layerParent, _ = layerParent[key].(map[string]interface{})
+			}
+			if baseParent == nil || layerParent == nil {
+				continue
+			}
+			key := field[len(field)-1]
+			baseValue, layerValue := baseParent[key], layerParent[key]
+			if _, ok := overriddenValue(layerValue); ok {
+				continue
+			}
+			_, baseIsList := baseValue.([]interface{})
+			_, layerIsList := layerValue.([]interface{})
+			_, baseIsMap := baseValue.(map[string]interface{})
+			_, layerIsMap := layerValue.(map[string]interface{})
+			if (baseIsList || layerIsList) && (baseIsList || baseIsMap) && (layerIsList || layerIsMap) {
+				baseParent[key] = keyValueMap(baseValue)
+				layerParent[key] = keyValueMap(layerValue)
+			}
+		}
+	}
+}
+
+// keyValueMap returns a list of KEY=value strings as a mapping; a KEY without a
+// value maps to null. Mappings are returned as they are.
+func keyValueMap(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	m := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		if item == resetMarker {
+			continue
+		}
+		key, value, hasValue := strings.Cut(fmt.Sprint(item), "=")
+		if hasValue {
+			m[key] = value
+		} else {
+			m[key] = nil
+		}
+	}
+	return m
+}
+
+// mergeConfigFiles reads and merges configuration files, lowest precedence first.
+func mergeConfigFiles(files []string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, file := range files {
+		layer, err := readConfigLayer(file)
+		if err != nil {
+			return nil, err
+		}
+		normalizeKeyValues(merged, layer)
+		merged = mergeConfig(merged, layer)
+	}
+	return stripMarkers(merged).(map[string]interface{}), nil
+}
+
+// readConfig merges the configuration layers, expands the variables in them,
+// applies the UPCTL_ overrides and resolves secret references, then loads the
+// result into viper. The variables come from the environment and the .env file next
+// to the project file. viper.ConfigFileUsed returns the project file afterwards, or
+// the defaults file when there is none.
+func readConfig(explicit string) error {
+	files, err := configLayerFiles(explicit)
+	if err != nil {
+		return err
+	}
+	used := files[len(files)-1]
+	if len(files) > 1 && used == overrideConfigPath(files[len(files)-2]) {
+		used = files[len(files)-2]
+	}
+	merged, err := mergeConfigFiles(files)
+	if err != nil {
+		return err
+	}
+	env, err := configEnv(used)
+	if err != nil {
+		return err
+	}
+	if err := interpolateConfig(merged, env); err != nil {
+		return err
+	}
+	if err := applyEnvOverrides(merged, env); err != nil {
+		return err
+	}
+	if err := resolveSecrets(merged); err != nil {
+		return err
+	}
+	// Services keep the case of their keys, such as environment variable names,
+	// so they don't go through viper's key folding.
+	services := merged["services"]
+	delete(merged, "services")
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	viper.SetConfigFile(used)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if services != nil {
+		viper.Set("services", rawSection{value: services})
+	} else {
+		viper.Set("services", nil)
+	}
+	configFiles = files
+	return nil
+}
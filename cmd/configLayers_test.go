@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// chdir changes the working directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get the working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestConfigLayerFiles(t *testing.T) {
+	home, project := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	chdir(t, project)
+
+	if _, err := configLayerFiles(""); err != errNoConfigFile {
+		t.Errorf("Expected errNoConfigFile without any config file, got %v", err)
+	}
+
+	writeConfigFile(t, filepath.Join(home, ".upctl.yaml"), "project: home\n")
+	files, err := configLayerFiles("")
+	if err != nil || !equalSlices(files, []string{filepath.Join(home, ".upctl.yaml")}) {
+		t.Errorf("Expected only the home file, got %v, %v", files, err)
+	}
+
+	writeConfigFile(t, "upctl.yaml", "project: app\n")
+	writeConfigFile(t, "upctl.override.yaml", "project: mine\n")
+	files, err = configLayerFiles("")
+	want := []string{filepath.Join(home, ".upctl.yaml"), "upctl.yaml", "upctl.override.yaml"}
+	if err != nil || !equalSlices(files, want) {
+		t.Errorf("Expected %v, got %v, %v", want, files, err)
+	}
+
+	explicit := filepath.Join(t.TempDir(), "ci.yaml")
+	writeConfigFile(t, explicit, "project: ci\n")
+	files, err = configLayerFiles(explicit)
+	want = []string{filepath.Join(home, ".upctl.yaml"), explicit}
+	if err != nil || !equalSlices(files, want) {
+		t.Errorf("Expected --config to replace the project file, got %v, %v", files, err)
+	}
+
+	if _, err := configLayerFiles(filepath.Join(project, "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing --config file")
+	}
+}
+
+func TestReadConfig_Layers(t *testing.T) {
+	home, project := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	chdir(t, project)
+	viper.Reset()
+	defer viper.Reset()
+
+	writeConfigFile(t, filepath.Join(home, ".upctl.yaml"), `
+teleport:
+  host: teleport.example.com
+  aws_role: dev
+`)
+	writeConfigFile(t, "upctl.yaml", `
+project: app
+teleport:
+  aws_app: aws
+services:
+  api:
+    image: api:1.0
+    ports: ["8080:8080"]
+    environment:
+      LOG_LEVEL: info
+      DEBUG: "false"
+    labels:
+      team: core
+  worker:
+    image: worker:1.0
+`)
+	writeConfigFile(t, "upctl.override.yaml", `
+services:
+  api:
+    ports: ["9090:8080"]
+    environment:
+      LOG_LEVEL: debug
+      DEBUG: !reset
+    labels: !override
+      owner: me
+  worker: !reset null
+`)
+
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	if got := viper.ConfigFileUsed(); got != "upctl.yaml" {
+		t.Errorf("Expected the project file to be reported as used, got %q", got)
+	}
+	if got := viper.GetString("teleport.host"); got != "teleport.example.com" {
+		t.Errorf("Expected teleport.host from the home file, got %q", got)
+	}
+	if got := viper.GetString("teleport.aws_app"); got != "aws" {
+		t.Errorf("Expected teleport.aws_app from the project file, got %q", got)
+	}
+
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	if _, ok := cfg.Services["worker"]; ok {
+		t.Errorf("Expected !reset to remove the worker service, got %v", cfg.Services)
+	}
+	api := cfg.Services["api"]
+	if api.Image != "api:1.0" {
+		t.Errorf("Expected the image to be inherited, got %v", api.Image)
+	}
+	if len(api.Ports) != 1 || api.Ports[0].Published != "9090" {
+		t.Errorf("Expected lists to be replaced, got %+v", api.Ports)
+	}
+	if !equalSlices(api.Environment.Keys, []string{"LOG_LEVEL"}) {
+		t.Errorf("Expected only LOG_LEVEL in the environment, got %v", api.Environment.Keys)
+	}
+	if value, _ := api.Environment.Get("LOG_LEVEL"); value != "debug" {
+		t.Errorf("Expected LOG_LEVEL=debug, got %q", value)
+	}
+	if !equalSlices(api.Labels.Keys, []string{"owner"}) {
+		t.Errorf("Expected !override to replace the labels, got %v", api.Labels.Keys)
+	}
+}
+
+func TestMergeConfig_MarkersWithoutBase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "upctl.yaml")
+	writeConfigFile(t, path, `
+services:
+  api:
+    environment: !override
+      A: "1"
+    labels: !reset
+`)
+	merged, err := mergeConfigFiles([]string{path})
+	if err != nil {
+		t.Fatalf("mergeConfigFiles() returned an error: %v", err)
+	}
+	want := map[string]interface{}{
+		"services": map[string]interface{}{
+			"api": map[string]interface{}{"environment": map[string]interface{}{"A": "1"}},
+		},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Expected %v, got %v", want, merged)
+	}
+}
+
+func TestLoadConfig_KeepsStdoutClean(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	chdir(t, t.TempDir())
+	viper.Reset()
+	defer viper.Reset()
+	originalTeleport, originalMySQL, originalDocker, originalCfgFile := teleportConfig, mysqlConfig, dockerConfig, cfgFile
+	defer func() {
+		teleportConfig, mysqlConfig, dockerConfig, cfgFile = originalTeleport, originalMySQL, originalDocker, originalCfgFile
+	}()
+	cfgFile = ""
+	writeConfigFile(t, "upctl.yaml", "project: app\n")
+
+	var err error
+	output := captureOutput(func() { err = loadConfig() })
+	if err != nil {
+		t.Fatalf("loadConfig() returned an error: %v", err)
+	}
+	if output != "" {
+		t.Errorf("Expected nothing on stdout, so that 'ps -o json' stays parseable, got %q", output)
+	}
+}
+
+func TestReadConfig_MergesListAndMapForms(t *testing.T) {
+	setup(t)
+	defer teardown()
+	t.Setenv("HOME", t.TempDir())
+	chdir(t, t.TempDir())
+
+	writeConfigFile(t, "upctl.yaml", `
+project: app
+services:
+  api:
+    image: api:1.0
+    environment:
+      - LOG_LEVEL=info
+      - DB_HOST=db
+      - API_TOKEN
+    labels:
+      com.example.Team: core
+    build:
+      context: .
+      args: ["VERSION=1.0"]
+`)
+	writeConfigFile(t, "upctl.override.yaml", `
+services:
+  api:
+    environment:
+      LOG_LEVEL: debug
+      API_TOKEN: !reset
+    labels:
+      - com.example.Owner=me
+    build:
+      args:
+        COMMIT: abc123
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	api := cfg.Services["api"]
+	wantEnv := map[string]string{"LOG_LEVEL": "debug", "DB_HOST": "db"}
+	if len(api.Environment.Keys) != len(wantEnv) {
+		t.Errorf("Expected the environment %v, got %v", wantEnv, api.Environment.Keys)
+	}
+	for key, want := range wantEnv {
+		if value, _ := api.Environment.Get(key); value != want {
+			t.Errorf("Expected %s=%s, got %q", key, want, value)
+		}
+	}
+	for _, key := range []string{"com.example.Team", "com.example.Owner"} {
+		if _, ok := api.Labels.Get(key); !ok {
+			t.Errorf("Expected the label %s, got %v", key, api.Labels.Keys)
+		}
+	}
+	if api.Build == nil {
+		t.Fatalf("Expected the build section to be kept")
+	}
+	for _, key := range []string{"VERSION", "COMMIT"} {
+		if _, ok := api.Build.Args.Get(key); !ok {
+			t.Errorf("Expected the build arg %s, got %v", key, api.Build.Args.Keys)
+		}
+	}
+
+	path, err := writeComposeFile()
+	if err != nil {
+		t.Fatalf("writeComposeFile() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the compose file: %v", err)
+	}
+	for _, want := range []string{"LOG_LEVEL: debug", "DB_HOST: db"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in the compose file, got:\n%s", want, data)
+		}
+	}
+}
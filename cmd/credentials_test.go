@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// testSecret contains shell metacharacters to catch any command built as a shell string.
+const testSecret = `s3cr'et$(touch /tmp/pwned);"`
+
+// recordAllCommands replaces every way upctl runs a command with mocks that record into mockExecuteTracker.
+func recordAllCommands(t *testing.T) {
+	originalExecute, originalCapture, originalStream := ExecuteCommand, CaptureCommand, StreamCommand
+	ExecuteCommand = mockExecuteCommandVolumes
+	StreamCommand = mockStreamCommand
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		return "container-id\n", nil
+	}
+	mockExecuteTracker = []MockExecuteCommand{}
+	t.Cleanup(func() {
+		ExecuteCommand, CaptureCommand, StreamCommand = originalExecute, originalCapture, originalStream
+	})
+}
+
+// assertSecretNotInArgs fails if the secret was passed in the arguments of any command.
+func assertSecretNotInArgs(t *testing.T, secret string) {
+	t.Helper()
+	for _, call := range mockExecuteTracker {
+		if strings.Contains(call.Command, secret) {
+			t.Errorf("Secret found in command name: %s", call.Command)
+		}
+		for _, arg := range call.Args {
+			if strings.Contains(arg, secret) {
+				t.Errorf("Secret found in the arguments of %s %v", call.Command, call.Args)
+			}
+		}
+	}
+}
+
+func TestCredentials_NeverInArguments(t *testing.T) {
+	t.Run("import-db", func(t *testing.T) {
+		setup(t)
+		defer teardown()
+		recordAllCommands(t)
+
+		dbFile := filepath.Join(t.TempDir(), "dump.sql")
+		if err := os.WriteFile(dbFile, []byte("SELECT 1;\n"), 0600); err != nil {
+			t.Fatalf("Failed to write dump: %v", err)
+		}
+		originalConfig := mysqlConfig
+		defer func() { mysqlConfig = originalConfig }()
+		mysqlConfig = MySQLConfig{User: "user", Password: testSecret, Database: "db", DBFile: dbFile}
+		viper.Set("services", map[string]interface{}{"mysql": map[string]interface{}{"image": "mysql:8.0"}})
+
+		if err := RunDockerImportDB(&cobra.Command{}, nil); err != nil {
+			t.Fatalf("RunDockerImportDB() returned an error: %v", err)
+		}
+		assertSecretNotInArgs(t, testSecret)
+
+		last := mockExecuteTracker[len(mockExecuteTracker)-1]
+		if !equalSlices(last.Env, []string{"MYSQL_PWD=" + testSecret}) || !contains(last.Args, "MYSQL_PWD") {
+			t.Errorf("Expected the password to be passed through MYSQL_PWD, got %s %v with env %v", last.Command, last.Args, last.Env)
+		}
+	})
+
+	t.Run("config docker", func(t *testing.T) {
+		t.Setenv("UPCTL_HOME", t.TempDir())
+		recordAllCommands(t)
+		originalConfig := dockerConfig
+		defer func() { dockerConfig = originalConfig }()
+		dockerConfig = DockerConfig{Registry: "registry.example.com", Username: "AWS", Password: testSecret}
+
+		if err := configDocker(); err != nil {
+			t.Fatalf("configDocker() returned an error: %v", err)
+		}
+		assertSecretNotInArgs(t, testSecret)
+		if len(mockExecuteTracker) != 1 || mockExecuteTracker[0].Command != "docker" || mockExecuteTracker[0].Stdin != testSecret {
+			t.Errorf("Expected docker login with the password on stdin, got %v", mockExecuteTracker)
+		}
+	})
+
+	t.Run("config repo", func(t *testing.T) {
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		viper.Set("repositories", []map[string]interface{}{
+			{"name": "private", "url": "https://charts.example.com", "username": "bob", "password": testSecret},
+		})
+		recordAllCommands(t)
+
+		if err := RunHelmRepoConfig(); err != nil {
+			t.Fatalf("RunHelmRepoConfig() returned an error: %v", err)
+		}
+		assertSecretNotInArgs(t, testSecret)
+		if mockExecuteTracker[0].Stdin != testSecret {
+			t.Errorf("Expected the repository password on stdin, got %q", mockExecuteTracker[0].Stdin)
+		}
+	})
+}
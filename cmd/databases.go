@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Database engines of a database target.
+const (
+	engineMySQL    = "mysql"
+	enginePostgres = "postgres"
+)
+
+// pgCustomDumpMagic starts every PostgreSQL custom-format dump (pg_dump -Fc).
+const pgCustomDumpMagic = "PGDMP"
+
+// DatabaseTarget is a database from the 'databases' section of upctl.yaml: the
+// Compose service it runs in, how to log in, and where its dump comes from.
+type DatabaseTarget struct {
+	Name     string `mapstructure:"name"`
+	Service  string `mapstructure:"service"`
+	Engine   string `mapstructure:"engine"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"`
+	DBFile   string `mapstructure:"db_file"`
+	S3Bucket string `mapstructure:"s3_bucket"`
+	S3Key    string `mapstructure:"s3_key"`
+	S3Region string `mapstructure:"s3_region"`
+
+	Source     DumpSourceConfig `mapstructure:"source"`
+	PostImport []PostImportHook `mapstructure:"post_import"`
+}
+
+// legacyDatabaseTarget turns the single 'mysql' section used before 'databases'
+// existed into a target named "mysql" in the "mysql" service.
+func legacyDatabaseTarget(cfg MySQLConfig) DatabaseTarget {
+	return DatabaseTarget{
+		Name:     engineMySQL,
+		Service:  engineMySQL,
+		Engine:   engineMySQL,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Database: cfg.Database,
+		DBFile:   cfg.DBFile,
+		S3Bucket: cfg.S3Bucket,
+		S3Key:    cfg.S3Key,
+		S3Region: cfg.S3Region,
+
+		PostImport: cfg.PostImport,
+	}
+}
+
+// loadDatabaseTargets reads the 'databases' section of upctl.yaml. Without it the
+// 'mysql' section is used as a single target, so older configurations keep working.
+func loadDatabaseTargets() ([]DatabaseTarget, error) {
+	var targets []DatabaseTarget
+	if err := viper.UnmarshalKey("databases", &targets); err != nil {
+		return nil, configError(err, "error loading databases")
+	}
+	if len(targets) == 0 {
+		legacy := legacyDatabaseTarget(mysqlConfig)
+		if err := validatePostImportHooks(legacy); err != nil {
+			return nil, err
+		}
+		return []DatabaseTarget{legacy}, nil
+	}
+
+	seen := make(map[string]bool, len(targets))
+	for i := range targets {
+		target := &targets[i]
+		if target.Name == "" {
+			return nil, configError(nil, "every database needs a name")
+		}
+		if seen[target.Name] {
+			return nil, configError(nil, "database '%s' is defined more than once", target.Name)
+		}
+		seen[target.Name] = true
+		if target.Service == "" {
+			return nil, configError(nil, "database '%s' has no service", target.Name)
+		}
+		if target.Engine == "" {
+			target.Engine = engineMySQL
+		}
+		if _, ok := databaseEngines[target.Engine]; !ok {
+			return nil, configError(nil, "database '%s' has unsupported engine '%s'", target.Name, target.Engine)
+		}
+		if err := validatePostImportHooks(*target); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// selectDatabaseTargets returns the targets named in args, or all targets when all
+// is set. Without arguments the only target is used when there is just one.
+func selectDatabaseTargets(args []string, all bool) ([]DatabaseTarget, error) {
+	if all && len(args) > 0 {
+		return nil, usageError("cannot specify database names when the --all flag is used")
+	}
+	targets, err := loadDatabaseTargets()
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return targets, nil
+	}
+	if len(args) == 0 {
+		if len(targets) == 1 {
+			return targets, nil
+		}
+		return nil, usageError("several databases are configured; name one or use --all")
+	}
+
+	byName := make(map[string]DatabaseTarget, len(targets))
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		byName[target.Name] = target
+		names = append(names, target.Name)
+	}
+	var selected []DatabaseTarget
+	var unknown []string
+	for _, name := range args {
+		target, ok := byName[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected = append(selected, target)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(names)
+		return nil, notFoundError("database(s)", unknown, names)
+	}
+	return selected, nil
+}
+
+// databaseTarget returns the target named name, or the only target when name is empty.
+func databaseTarget(name string) (DatabaseTarget, error) {
+	var args []string
+	if name != "" {
+		args = []string{name}
+	}
+	targets, err := selectDatabaseTargets(args, false)
+	if err != nil {
+		return DatabaseTarget{}, err
+	}
+	return targets[0], nil
+}
+
+// checkDatabaseServices reports targets whose service is not configured. It needs
+// dockerComposeConfig to be loaded.
+func checkDatabaseServices(targets []DatabaseTarget) error {
+	for _, target := range targets {
+		if _, ok := dockerComposeConfig.Services[target.Service]; !ok {
+			return configError(nil, "database '%s' uses service '%s', which is not in 'services'", target.Name, target.Service)
+		}
+	}
+	return nil
+}
+
+// databaseEngine knows the client commands of a database engine. The commands get
+// the password from the environment variables returned with them.
+type databaseEngine struct {
+	// prepare readies the database for an import, e.g. creates it. It is optional.
+	prepare func(rt Runtime, target DatabaseTarget) error
+	// importCommand returns the command reading a dump from stdin; header holds the
+	// first bytes of the decompressed dump so the format can be told apart.
+	importCommand func(target DatabaseTarget, header []byte) ([]string, []string)
+	dumpCommand   func(target DatabaseTarget) ([]string, []string)
+}
+
+// databaseEngines lists the supported engines by the name used in upctl.yaml.
+var databaseEngines = map[string]databaseEngine{
+	engineMySQL: {
+		importCommand: func(target DatabaseTarget, header []byte) ([]string, []string) {
+			// MYSQL_PWD keeps the password out of the process list and away from any shell.
+			return []string{"mysql", "-u", target.User, target.Database}, []string{"MYSQL_PWD=" + target.Password}
+		},
+		dumpCommand: func(target DatabaseTarget) ([]string, []string) {
+			return []string{"mysqldump", "-u", target.User, "--single-transaction", "--routines", "--triggers", target.Database},
+				[]string{"MYSQL_PWD=" + target.Password}
+		},
+	},
+	enginePostgres: {
+		prepare: createPostgresDatabase,
+		importCommand: func(target DatabaseTarget, header []byte) ([]string, []string) {
+			env := []string{"PGPASSWORD=" + target.Password}
+			if bytes.HasPrefix(header, []byte(pgCustomDumpMagic)) {
+				// --clean drops what the dump restores first, so that it can be
+				// restored into a database that already holds it.
+				return []string{"pg_restore", "-U", target.User, "-d", target.Database, "--no-owner", "--no-privileges", "--clean", "--if-exists"}, env
+			}
+			return []string{"psql", "-U", target.User, "-d", target.Database, "-v", "ON_ERROR_STOP=1", "--quiet"}, env
+		},
+		dumpCommand: func(target DatabaseTarget) ([]string, []string) {
+			// Plain SQL, so that snapshots restore through psql like any other dump.
+			// The dump drops every object before creating it, like mysqldump does,
+			// so that it can be restored over the database it was taken from.
+			return []string{"pg_dump", "-U", target.User, "--no-owner", "--clean", "--if-exists", target.Database},
+				[]string{"PGPASSWORD=" + target.Password}
+		},
+	},
+}
+
+// createPostgresDatabase creates a target's database unless it already exists,
+// connecting to the 'postgres' maintenance database to check.
+func createPostgresDatabase(rt Runtime, target DatabaseTarget) error {
+	env := []string{"PGPASSWORD=" + target.Password}
+	query := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = '%s'", strings.ReplaceAll(target.Database, "'", "''"))
+	var out bytes.Buffer
+	if err := rt.Exec(target.Service, []string{"psql", "-U", target.User, "-d", "postgres", "-tAc", query}, CommandIO{Stdout: &out, Env: env}); err != nil {
+		return toolError(err, "error checking whether database '%s' exists", target.Name)
+	}
+	if strings.TrimSpace(out.String()) == "1" {
+		return nil
+	}
+	fmt.Printf("Creating database %s...\n", target.Database)
+	if err := rt.Exec(target.Service, []string{"createdb", "-U", target.User, target.Database}, CommandIO{Env: env}); err != nil {
+		return toolError(err, "error creating database '%s'", target.Name)
+	}
+	return nil
+}
+
+// importDump streams a dump file into the database client of a target's service,
+// drawing a progress line on progressOut.
+func importDump(rt Runtime, target DatabaseTarget, dbFilePath string, progressOut io.Writer) error {
+	engine := databaseEngines[target.Engine]
+	if engine.prepare != nil {
+		if err := engine.prepare(rt, target); err != nil {
+			return err
+		}
+	}
+
+	dump, err := openDump(dbFilePath, progressOut)
+	if err != nil {
+		return toolError(err, "error opening database dump '%s'", dbFilePath)
+	}
+	defer dump.Close()
+
+	// The header is peeked rather than read so it still reaches the client.
+	reader := bufio.NewReader(dump)
+	header, _ := reader.Peek(len(pgCustomDumpMagic))
+	importCmd, env := engine.importCommand(target, header)
+	errImport := rt.Exec(target.Service, importCmd, CommandIO{Stdin: reader, Env: env})
+	dump.progress.finish()
+	errClose := dump.Close()
+	if errImport != nil {
+		return toolError(errImport, "error importing database '%s'", target.Name)
+	}
+	if errClose != nil {
+		return toolError(errClose, "error reading the dump of database '%s'; the import may be incomplete", target.Name)
+	}
+	return nil
+}
+
+// importDatabases imports the dump of every target. Targets in the same service
+// are imported one after the other; different services are imported in parallel.
+// A single import draws a live progress line, parallel ones only report when done.
+func importDatabases(rt Runtime, targets []DatabaseTarget, dumps map[string]string) error {
+	byService := make(map[string][]DatabaseTarget)
+	var services []string
+	for _, target := range targets {
+		if _, ok := byService[target.Service]; !ok {
+			services = append(services, target.Service)
+		}
+		byService[target.Service] = append(byService[target.Service], target)
+	}
+
+	// The progress lines replace the spinner while dumps are streamed.
+	progress.Stop()
+	progressOut := io.Writer(os.Stderr)
+	if len(services) > 1 {
+		progressOut = io.Discard
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(services))
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service string) {
+			defer wg.Done()
+			for _, target := range byService[service] {
+				fmt.Printf("Importing %s into database %s...\n", filepath.Base(dumps[target.Name]), target.Name)
+				if err := importDump(rt, target, dumps[target.Name], progressOut); err != nil {
+					errs[i] = err
+					return
+				}
+				if err := runPostImportHooks(rt, target); err != nil {
+					errs[i] = err
+					return
+				}
+				fmt.Printf("Database %s imported\n", target.Name)
+			}
+		}(i, service)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const databasesTestConfig = `
+services:
+  mysql:
+    image: mysql:8.0
+  reporting-mysql:
+    image: mysql:8.0
+databases:
+  - name: app
+    service: mysql
+    user: app
+    password: app-pwd
+    database: app
+  - name: audit
+    service: mysql
+    engine: mysql
+    user: audit
+    password: audit-pwd
+    database: audit
+  - name: reporting
+    service: reporting-mysql
+    user: report
+    password: report-pwd
+    database: reporting
+`
+
+func setupDatabasesTest(t *testing.T) {
+	setup(t)
+	t.Cleanup(teardown)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(databasesTestConfig)); err != nil {
+		t.Fatalf("Failed to read test config: %v", err)
+	}
+}
+
+func TestLoadDatabaseTargets(t *testing.T) {
+	setupDatabasesTest(t)
+
+	targets, err := loadDatabaseTargets()
+	if err != nil {
+		t.Fatalf("loadDatabaseTargets() returned an error: %v", err)
+	}
+	if len(targets) != 3 || targets[0].Engine != engineMySQL || targets[2].Service != "reporting-mysql" {
+		t.Errorf("Unexpected targets: %+v", targets)
+	}
+
+	if _, err := selectDatabaseTargets(nil, false); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error without a name when several databases are configured, got %v", err)
+	}
+	if _, err := selectDatabaseTargets([]string{"app", "nope"}, false); ExitCode(err) != ExitServiceNotFound || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected a not found error for nope, got %v", err)
+	}
+
+	viper.Set("databases", []map[string]interface{}{{"name": "pg", "service": "postgres", "engine": "oracle"}})
+	if _, err := loadDatabaseTargets(); ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "unsupported engine 'oracle'") {
+		t.Errorf("Expected a config error for an unsupported engine, got %v", err)
+	}
+}
+
+func TestLoadDatabaseTargets_LegacyMySQLSection(t *testing.T) {
+	setup(t)
+	defer teardown()
+	originalConfig := mysqlConfig
+	defer func() { mysqlConfig = originalConfig }()
+	mysqlConfig = MySQLConfig{User: "user", Password: "pwd", Database: "db", DBFile: "/tmp/dump.sql"}
+
+	target, err := databaseTarget("")
+	if err != nil {
+		t.Fatalf("databaseTarget() returned an error: %v", err)
+	}
+	if target.Name != "mysql" || target.Service != "mysql" || target.Database != "db" || target.DBFile != "/tmp/dump.sql" {
+		t.Errorf("Unexpected legacy target: %+v", target)
+	}
+}
+
+func TestRunDockerImportDB_AllDatabases(t *testing.T) {
+	setupDatabasesTest(t)
+	rt := &fakeRuntime{}
+	useFakeRuntime(t, rt)
+
+	dir := t.TempDir()
+	var databases []map[string]interface{}
+	for _, name := range []string{"app", "audit", "reporting"} {
+		dbFile := filepath.Join(dir, name+".sql")
+		if err := os.WriteFile(dbFile, []byte("-- "+name+"\n"), 0600); err != nil {
+			t.Fatalf("Failed to write dump: %v", err)
+		}
+		service := "mysql"
+		if name == "reporting" {
+			service = "reporting-mysql"
+		}
+		databases = append(databases, map[string]interface{}{"name": name, "service": service, "database": name, "db_file": dbFile})
+	}
+	viper.Set("databases", databases)
+
+	importCmd := &cobra.Command{Use: "import-db", RunE: RunDockerImportDB}
+	importCmd.Flags().BoolP("all", "a", false, "")
+	importCmd.SetArgs([]string{"--all"})
+	if err := importCmd.Execute(); err != nil {
+		t.Fatalf("import-db --all failed: %v", err)
+	}
+
+	if rt.calls[0] != "start" || !equalSlices(rt.services[0], []string{"mysql", "reporting-mysql"}) {
+		t.Errorf("Expected both database services to be started once, got %v %v", rt.calls[0], rt.services[0])
+	}
+	imported := map[string]string{}
+	for i, call := range rt.calls {
+		if call == "exec" {
+			imported[rt.services[i][len(rt.services[i])-1]] = rt.services[i][0]
+		}
+	}
+	expected := map[string]string{"app": "mysql", "audit": "mysql", "reporting": "reporting-mysql"}
+	for database, service := range expected {
+		if imported[database] != service {
+			t.Errorf("Expected database %s to be imported in service %s, got imports %v", database, service, imported)
+		}
+	}
+	for _, name := range []string{"app", "audit", "reporting"} {
+		if !strings.Contains(string(rt.stdin), "-- "+name) {
+			t.Errorf("Expected the dump of %s to be streamed, got %q", name, rt.stdin)
+		}
+	}
+}
+
+func TestImportDump_Postgres(t *testing.T) {
+	setup(t)
+	defer teardown()
+	target := DatabaseTarget{Name: "app", Service: "postgres", Engine: enginePostgres, User: "app", Password: "pg-secret", Database: "app"}
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "app.sql")
+	custom := filepath.Join(dir, "app.dump")
+	if err := os.WriteFile(plain, []byte("CREATE TABLE t (id INT);\n"), 0600); err != nil {
+		t.Fatalf("Failed to write dump: %v", err)
+	}
+	if err := os.WriteFile(custom, []byte(pgCustomDumpMagic+"\x01\x0e\x00binary"), 0600); err != nil {
+		t.Fatalf("Failed to write dump: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		dump       string
+		exists     string
+		wantCalls  []string
+		wantClient string
+	}{
+		{name: "plain SQL into a new database", dump: plain, exists: "", wantCalls: []string{"psql", "createdb", "psql"}, wantClient: "psql"},
+		{name: "custom format into an existing database", dump: custom, exists: "1\n", wantCalls: []string{"psql", "pg_restore"}, wantClient: "pg_restore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &fakeRuntime{execOutput: tt.exists}
+			if err := importDump(rt, target, tt.dump, io.Discard); err != nil {
+				t.Fatalf("importDump() returned an error: %v", err)
+			}
+			var commands []string
+			for i, call := range rt.services {
+				if rt.calls[i] != "exec" || call[0] != "postgres" {
+					t.Fatalf("Unexpected call %s %v", rt.calls[i], call)
+				}
+				commands = append(commands, call[1])
+				if strings.Contains(strings.Join(call, " "), "pg-secret") {
+					t.Errorf("Password passed on the command line: %v", call)
+				}
+			}
+			if !equalSlices(commands, tt.wantCalls) {
+				t.Errorf("Expected commands %v, got %v", tt.wantCalls, commands)
+			}
+			data, _ := os.ReadFile(tt.dump)
+			if string(rt.stdin) != string(data) {
+				t.Errorf("Expected the whole dump to be streamed to %s, got %q", tt.wantClient, rt.stdin)
+			}
+		})
+	}
+}
+
+func TestPostgresEngineCommands(t *testing.T) {
+	engine := databaseEngines[enginePostgres]
+	target := DatabaseTarget{User: "app", Password: "pg-secret", Database: "app"}
+
+	dump, env := engine.dumpCommand(target)
+	if want := []string{"pg_dump", "-U", "app", "--no-owner", "--clean", "--if-exists", "app"}; !equalSlices(dump, want) {
+		t.Errorf("Expected dump command %v, got %v", want, dump)
+	}
+	if !equalSlices(env, []string{"PGPASSWORD=pg-secret"}) {
+		t.Errorf("Expected the password in the environment, got %v", env)
+	}
+
+	restore, _ := engine.importCommand(target, []byte(pgCustomDumpMagic+"\x01"))
+	if want := []string{"pg_restore", "-U", "app", "-d", "app", "--no-owner", "--no-privileges", "--clean", "--if-exists"}; !equalSlices(restore, want) {
+		t.Errorf("Expected restore command %v, got %v", want, restore)
+	}
+	plain, _ := engine.importCommand(target, []byte("--\n-- PostgreSQL database dump\n"))
+	if want := []string{"psql", "-U", "app", "-d", "app", "-v", "ON_ERROR_STOP=1", "--quiet"}; !equalSlices(plain, want) {
+		t.Errorf("Expected import command %v, got %v", want, plain)
+	}
+}
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotExt is the file extension of saved snapshots; they are always gzip compressed.
+const snapshotExt = ".sql.gz"
+
+// snapshotNamePattern limits snapshot names to what is safe as a file name.
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// dumpDatabase dumps a database target from inside its container and writes the
+// dump to path, gzip compressed when compress is set. The dump is written to a
+// '.part' file first and renamed once complete, so a failed dump never leaves a
+// truncated file behind. It returns the size of the written file.
+func dumpDatabase(rt Runtime, target DatabaseTarget, path string, compress bool) (int64, error) {
+	if err := checkDatabaseServices([]DatabaseTarget{target}); err != nil {
+		return 0, err
+	}
+	if _, err := rt.ContainerID(target.Service); err != nil {
+		return 0, toolError(err, "service '%s' is not running; start it with 'upctl up %s'", target.Service, target.Service)
+	}
+
+	partPath := path + ".part"
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("error creating dump file '%s': %w", partPath, err)
+	}
+	removePart := func() {
+		file.Close()
+		os.Remove(partPath)
+	}
+	unregister := onInterrupt(removePart)
+	defer unregister()
+
+	counter := &countingWriter{w: file}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+
+	dumpCmd, env := databaseEngines[target.Engine].dumpCommand(target)
+	if err := rt.Exec(target.Service, dumpCmd, CommandIO{Stdout: out, Env: env}); err != nil {
+		removePart()
+		return 0, toolError(err, "error dumping database '%s'", target.Name)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			removePart()
+			return 0, fmt.Errorf("error compressing dump: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		removePart()
+		return 0, fmt.Errorf("error writing dump file '%s': %w", partPath, err)
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		removePart()
+		return 0, fmt.Errorf("error saving dump file '%s': %w", path, err)
+	}
+	return counter.n, nil
+}
+
+// RunDbDump writes a dump of the local database to --out, or to a timestamped file
+// in the current directory.
+func RunDbDump(cmd *cobra.Command, args []string) error {
+	progress.Start()
+	defer progress.Stop()
+
+	target, err := databaseTarget(databaseFlag(cmd))
+	if err != nil {
+		return err
+	}
+	out, _ := cmd.Flags().GetString("out")
+	compress, _ := cmd.Flags().GetBool("compress")
+	if out == "" {
+		out = fmt.Sprintf("%s-%s.sql", target.Database, time.Now().Format("20060102-150405"))
+		if compress {
+			out += ".gz"
+		}
+	} else if strings.HasSuffix(out, ".gz") {
+		compress = true
+	} else if compress {
+		return usageError("--compress writes gzip data, so --out '%s' must end in .gz", out)
+	}
+	path, err := cleanPath(out)
+	if err != nil {
+		return usageError("invalid --out '%s': %s", out, err)
+	}
+
+	rt, err := projectRuntime()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dumping database %s...\n", target.Name)
+	size, err := dumpDatabase(rt, target, path, compress)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database dumped to %s (%s)\n", path, formatBytes(size))
+	return nil
+}
+
+// databaseFlag returns the value of a command's --database flag.
+func databaseFlag(cmd *cobra.Command) string {
+	name, _ := cmd.Flags().GetString("database")
+	return name
+}
+
+// snapshotDir returns the directory the snapshots of a database target are kept in,
+// ~/.upctl/snapshots/<project>/<database>, creating it if needed.
+func snapshotDir(target DatabaseTarget) (string, error) {
+	if err := checkProjectName(); err != nil {
+		return "", err
+	}
+	home, err := upctlHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, "snapshots", projectName(), target.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating snapshot directory '%s': %s", dir, err)
+	}
+	return dir, nil
+}
+
+// snapshotPath returns the file of a named snapshot of a database target.
+func snapshotPath(target DatabaseTarget, name string) (string, error) {
+	if !snapshotNamePattern.MatchString(name) {
+		return "", usageError("invalid snapshot name '%s': use letters, digits, '.', '_' and '-'", name)
+	}
+	dir, err := snapshotDir(target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+snapshotExt), nil
+}
+
+// Snapshot is a saved database snapshot.
+type Snapshot struct {
+	Name    string
+	Size    int64
+	Created time.Time
+}
+
+// listSnapshots returns the snapshots of a database target sorted by name.
+func listSnapshots(target DatabaseTarget) ([]Snapshot, error) {
+	dir, err := snapshotDir(target)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot directory '%s': %w", dir, err)
+	}
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{
+			Name:    strings.TrimSuffix(entry.Name(), snapshotExt),
+			Size:    info.Size(),
+			Created: info.ModTime(),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots, nil
+}
+
+// RunDbSnapshotSave saves the local database as a named snapshot.
+func RunDbSnapshotSave(cmd *cobra.Command, args []string) error {
+	progress.Start()
+	defer progress.Stop()
+
+	target, err := databaseTarget(databaseFlag(cmd))
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	path, err := snapshotPath(target, name)
+	if err != nil {
+		return err
+	}
+	force, _ := cmd.Flags().GetBool("force")
+	if _, err := os.Stat(path); err == nil && !force {
+		return usageError("snapshot '%s' already exists; use --force to overwrite it", name)
+	}
+
+	rt, err := projectRuntime()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Saving snapshot %s of database %s...\n", name, target.Name)
+	size, err := dumpDatabase(rt, target, path, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot %s saved (%s)\n", name, formatBytes(size))
+	return nil
+}
+
+// RunDbSnapshotRestore imports a named snapshot into the local database through
+// the same streaming pipeline as import-db.
+func RunDbSnapshotRestore(cmd *cobra.Command, args []string) error {
+	progress.Start()
+	defer progress.Stop()
+
+	target, err := databaseTarget(databaseFlag(cmd))
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	path, err := snapshotPath(target, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		snapshots, _ := listSnapshots(target)
+		available := make([]string, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			available = append(available, snapshot.Name)
+		}
+		return notFoundError("snapshot", []string{name}, available)
+	}
+
+	rt, err := projectRuntime()
+	if err != nil {
+		return err
+	}
+
+	if err := checkDatabaseServices([]DatabaseTarget{target}); err != nil {
+		return err
+	}
+	fmt.Printf("Ensuring service %s is running...\n", target.Service)
+	if err := rt.Start([]string{target.Service}); err != nil {
+		return toolError(err, "error starting service %s", target.Service)
+	}
+	fmt.Printf("Restoring snapshot %s into database %s...\n", name, target.Name)
+	// The progress line replaces the spinner while the snapshot is streamed.
+	progress.Stop()
+	if err := importDump(rt, target, path, os.Stderr); err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot %s restored\n", name)
+	return nil
+}
+
+// RunDbSnapshotList prints the saved snapshots of the current project.
+func RunDbSnapshotList(cmd *cobra.Command, args []string) error {
+	target, err := databaseTarget(databaseFlag(cmd))
+	if err != nil {
+		return err
+	}
+	snapshots, err := listSnapshots(target)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Printf("No snapshots saved for database %s\n", target.Name)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tCREATED")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", snapshot.Name, formatBytes(snapshot.Size), snapshot.Created.Format("2006-01-02 15:04:05"))
+	}
+	return tw.Flush()
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db [command]",
+	Short: "Dump and snapshot the local database",
+	Long:  `Dumps a configured database from inside its container, and saves and restores named snapshots of it under ~/.upctl/snapshots/<project>/<database>.`,
+}
+
+var dbDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Dump the local database to a file",
+	Long:  `Runs the database's dump tool (mysqldump or pg_dump) inside its container and writes the dump to --out, or to <database>-<timestamp>.sql in the current directory. Use --compress, or an --out ending in .gz, for a gzip compressed dump; with --compress an --out name must end in .gz.`,
+	Args:  cobra.NoArgs,
+	RunE:  RunDbDump,
+}
+
+var dbSnapshotCmd = &cobra.Command{
+	Use:   "snapshot [command]",
+	Short: "Save, restore and list named database snapshots",
+}
+
+var dbSnapshotSaveCmd = &cobra.Command{
+	Use:   "save <name>",
+	Short: "Save the local database as a named snapshot",
+	Args:  cobra.ExactArgs(1),
+	RunE:  RunDbSnapshotSave,
+}
+
+var dbSnapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore a named snapshot into the local database",
+	Args:  cobra.ExactArgs(1),
+	RunE:  RunDbSnapshotRestore,
+}
+
+var dbSnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved snapshots",
+	Args:  cobra.NoArgs,
+	RunE:  RunDbSnapshotList,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{dbDumpCmd, dbSnapshotSaveCmd, dbSnapshotRestoreCmd, dbSnapshotListCmd} {
+		c.Flags().StringP("database", "d", "", "Database from the 'databases' section; needed when several are configured")
+	}
+	dbDumpCmd.Flags().StringP("out", "o", "", "File to write the dump to")
+	dbDumpCmd.Flags().BoolP("compress", "z", false, "Compress the dump with gzip")
+	dbSnapshotSaveCmd.Flags().BoolP("force", "f", false, "Overwrite an existing snapshot")
+
+	dbSnapshotCmd.AddCommand(dbSnapshotSaveCmd, dbSnapshotRestoreCmd, dbSnapshotListCmd)
+	dbCmd.AddCommand(dbDumpCmd, dbSnapshotCmd)
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const testDumpContent = "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);\n"
+
+func setupDbTest(t *testing.T) *fakeRuntime {
+	setup(t)
+	t.Cleanup(teardown)
+	rt := &fakeRuntime{execOutput: testDumpContent}
+	useFakeRuntime(t, rt)
+	originalConfig := mysqlConfig
+	t.Cleanup(func() { mysqlConfig = originalConfig })
+	mysqlConfig = MySQLConfig{User: "user", Password: "pwd", Database: "db"}
+	viper.Set("services", map[string]interface{}{"mysql": map[string]interface{}{"image": "mysql:8.0"}})
+	return rt
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s is not gzip compressed: %v", path, err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRunDbDump(t *testing.T) {
+	rt := setupDbTest(t)
+	dir := t.TempDir()
+
+	plain := filepath.Join(dir, "plain.sql")
+	dumpCmd := &cobra.Command{Use: "dump", RunE: RunDbDump}
+	dumpCmd.Flags().StringP("out", "o", "", "")
+	dumpCmd.Flags().BoolP("compress", "z", false, "")
+	dumpCmd.SetArgs([]string{"--out", plain})
+	if err := dumpCmd.Execute(); err != nil {
+		t.Fatalf("db dump failed: %v", err)
+	}
+	if data, _ := os.ReadFile(plain); string(data) != testDumpContent {
+		t.Errorf("Expected the mysqldump output in %s, got %q", plain, data)
+	}
+	last := rt.services[len(rt.services)-1]
+	if last[0] != "mysql" || last[1] != "mysqldump" || strings.Contains(strings.Join(last, " "), "pwd") {
+		t.Errorf("Unexpected dump command: %v", last)
+	}
+
+	compressed := filepath.Join(dir, "compressed.sql.gz")
+	dumpCmd.SetArgs([]string{"--out", compressed})
+	if err := dumpCmd.Execute(); err != nil {
+		t.Fatalf("db dump failed: %v", err)
+	}
+	if got := readGzipFile(t, compressed); got != testDumpContent {
+		t.Errorf("Expected the decompressed dump to match, got %q", got)
+	}
+	if _, err := os.Stat(compressed + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Expected no .part file to be left behind")
+	}
+
+	mismatched := filepath.Join(dir, "mismatched.sql")
+	dumpCmd.SetArgs([]string{"--compress", "--out", mismatched})
+	if err := dumpCmd.Execute(); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for --compress with a name without .gz, got %v", err)
+	}
+	if _, err := os.Stat(mismatched); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written to %s", mismatched)
+	}
+}
+
+func TestRunDbSnapshot_SaveListRestore(t *testing.T) {
+	rt := setupDbTest(t)
+
+	saveCmd := &cobra.Command{Use: "save", RunE: RunDbSnapshotSave}
+	saveCmd.Flags().BoolP("force", "f", false, "")
+	if err := saveCmd.RunE(saveCmd, []string{"before-migration"}); err != nil {
+		t.Fatalf("snapshot save failed: %v", err)
+	}
+	if err := saveCmd.RunE(saveCmd, []string{"before-migration"}); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error when overwriting without --force, got %v", err)
+	}
+
+	target, _ := databaseTarget("")
+	snapshots, err := listSnapshots(target)
+	if err != nil || len(snapshots) != 1 || snapshots[0].Name != "before-migration" {
+		t.Fatalf("Expected one snapshot, got %v (%v)", snapshots, err)
+	}
+	path, _ := snapshotPath(target, "before-migration")
+	if !strings.HasPrefix(path, filepath.Join(os.Getenv("UPCTL_HOME"), "snapshots")) {
+		t.Errorf("Expected the snapshot under UPCTL_HOME/snapshots, got %s", path)
+	}
+
+	if err := RunDbSnapshotRestore(&cobra.Command{}, []string{"before-migration"}); err != nil {
+		t.Fatalf("snapshot restore failed: %v", err)
+	}
+	if string(rt.stdin) != testDumpContent {
+		t.Errorf("Expected the snapshot to be streamed into mysql, got %q", rt.stdin)
+	}
+
+	if err := RunDbSnapshotRestore(&cobra.Command{}, []string{"missing"}); ExitCode(err) != ExitServiceNotFound {
+		t.Errorf("Expected a not found error for an unknown snapshot, got %v", err)
+	}
+	if _, err := snapshotPath(target, "../escape"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for an invalid snapshot name, got %v", err)
+	}
+}
@@ -1,159 +1,117 @@
 package cmd
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
-
-	// "regexp" // Not strictly needed anymore with JSON parsing for main fields
+	"path/filepath"
 	"sort"
 	"strings"
 
-	// "text/tabwriter" // Consider for more advanced table formatting if needed
-
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
 // DockerComposeConfig is the struct that holds the Docker Compose config values
 type DockerComposeConfig struct {
-	Services map[string]interface{} `mapstructure:"services" yaml:"services"`
-	Volumes  map[string]interface{} `mapstructure:"volumes" yaml:"volumes"`
-	Networks map[string]interface{} `mapstructure:"networks" yaml:"networks"`
+	Name     string                    `mapstructure:"-" yaml:"name,omitempty"`
+	Services map[string]ComposeService `mapstructure:"-" yaml:"services"`
+	Volumes  map[string]interface{}    `mapstructure:"volumes" yaml:"volumes"`
+	Networks map[string]interface{}    `mapstructure:"networks" yaml:"networks"`
 }
 
+// composeSections are the configuration sections rendered into the compose file.
+var composeSections = map[string]bool{"services": true, "volumes": true, "networks": true}
+
 // DockerPsJSONEntry defines the structure for a single service entry from `docker compose ps --format json`
 type DockerPsJSONEntry struct {
-	ID         string `json:"ID"`
-	Name       string `json:"Name"`
-	Image      string `json:"Image"`
-	Command    string `json:"Command"`
-	Project    string `json:"Project"`
-	Service    string `json:"Service"` // This is the crucial key linking to config service name
-	State      string `json:"State"`   // e.g., "running", "exited"
-	Status     string `json:"Status"`  // e.g., "Up 2 hours", "Exited (0) 2 minutes ago"
-	Health     string `json:"Health"`
-	ExitCode   int    `json:"ExitCode"`
-	Publishers []struct {
-		URL           string `json:"URL"`
-		TargetPort    int    `json:"TargetPort"`
-		PublishedPort int    `json:"PublishedPort"`
-		Protocol      string `json:"Protocol"`
-	} `json:"Publishers"`
+	ID         string        `json:"ID"`
+	Name       string        `json:"Name"`
+	Image      string        `json:"Image"`
+	Command    string        `json:"Command"`
+	Project    string        `json:"Project"`
+	Service    string        `json:"Service"` // This is the crucial key linking to config service name
+	State      string        `json:"State"`   // e.g., "running", "exited"
+	Status     string        `json:"Status"`  // e.g., "Up 2 hours", "Exited (0) 2 minutes ago"
+	Health     string        `json:"Health"`
+	ExitCode   int           `json:"ExitCode"`
+	Publishers []PsPublisher `json:"Publishers"`
 }
 
+// PsPublisher is a published port of a container in `docker compose ps --format json`.
+type PsPublisher = struct {
+	URL           string `json:"URL"`
+	TargetPort    int    `json:"TargetPort"`
+	PublishedPort int    `json:"PublishedPort"`
+	Protocol      string `json:"Protocol"`
+}
+
+// composeFileName is the name of the rendered compose file inside the project state directory.
+const composeFileName = "docker-compose.yml"
+
 var (
 	dockerComposeConfig DockerComposeConfig
 )
 
 // RunDockerComposePs lists running docker compose services and available services from config using JSON output.
-func RunDockerComposePs(cmd *cobra.Command, args []string) {
+func RunDockerComposePs(cmd *cobra.Command, args []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	format, _ := cmd.Flags().GetString("format")
+	if err := validatePsOutput(output, format); err != nil {
+		return err
+	}
+
 	progress.Start()
 	// Get available services from config
-	err := viper.Unmarshal(&dockerComposeConfig)
+	cfg, err := loadComposeConfig()
+	if err == nil {
+		args, err = expandGroups(args)
+	}
 	if err != nil {
-		fmt.Printf("Error loading docker compose config: %s\n", err.Error())
+		progress.Stop()
+		return err
 	}
+	dockerComposeConfig = cfg
 	availableServicesFromConfig := make(map[string]bool)
 	for serviceName := range dockerComposeConfig.Services {
 		availableServicesFromConfig[serviceName] = true
 	}
 
-	tempComposePath, err := createTempComposeFile()
+	rt, err := projectRuntime()
 	if err != nil {
-		progress.Stop() // Stop progress before printing error and exiting
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		progress.Stop() // Stop progress before returning the error
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
 	// Spinner is started in root.go's psCmd.Run. We will stop it after capture.
-	// fmt.Println("Listing Docker Compose services (running and available)...") // Removed this line
-
-	composePsBaseArgs := []string{"compose", "-f", tempComposePath}
-	composePsCmdArgs := append(composePsBaseArgs, "ps")
-	if len(args) > 0 {
-		composePsCmdArgs = append(composePsCmdArgs, args...)
-	}
-	composePsCmdArgs = append(composePsCmdArgs, "--format", "json")
-
-	psOutputStr, errCapture := CaptureCommand("docker", composePsCmdArgs...)
+	entries, errCapture := rt.Status(args)
 
 	progress.Stop() // Stop spinner immediately after command execution
 
 	if errCapture != nil {
 		// It's important that progress.Stop() was called before this print.
-		fmt.Printf("Note: Error executing 'docker compose ps --format json': %s. Output might be incomplete.\n", errCapture.Error())
+		// Notes go to stderr so that json/yaml output on stdout stays parseable.
+		fmt.Fprintf(os.Stderr, "Note: Error executing '%s compose ps --format json': %s. Output might be incomplete.\n", rt.Name(), errCapture.Error())
 	}
 
 	runningServicesDetails := make(map[string]DockerPsJSONEntry)
-	scanner := bufio.NewScanner(strings.NewReader(psOutputStr))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		var entry DockerPsJSONEntry
-		if errUnmarshal := json.Unmarshal([]byte(line), &entry); errUnmarshal != nil {
-			fmt.Fprintf(os.Stderr, "Warning: could not parse JSON line from 'docker compose ps': %v\nLine: %s\n", errUnmarshal, line)
-			continue
-		}
+	for _, entry := range entries {
 		if entry.Service != "" {
 			runningServicesDetails[entry.Service] = entry
 		}
 	}
-	if errScan := scanner.Err(); errScan != nil {
-		fmt.Fprintf(os.Stderr, "Error reading 'docker compose ps' output stream: %v\n", errScan)
-	}
-
-	headerToPrint := "CONFIG SERVICE   STATUS         NAME             IMAGE                      COMMAND                  SERVICE (PS)      STATE               PORTS"
-	fmt.Println(headerToPrint)
-	fmt.Println(strings.Repeat("-", len(headerToPrint)))
 
 	servicesToDisplay := make([]string, 0)
 	if len(args) > 0 {
-		tempServicesToDisplay := make(map[string]bool)
-		for _, argService := range args {
-			if availableServicesFromConfig[argService] {
-				tempServicesToDisplay[argService] = true
-			} else {
-				// If user specifies a service not in upctl.yaml, `docker compose ps <service_not_in_config>`
-				// would have already filtered it or errored. If it somehow appears in JSON (e.g. part of project but not config),
-				// we might choose to display it or ignore it. For now, we only focus on config-known services.
-				// However, the `docker compose ps <service_name>` call might return valid JSON for a service not in upctl.yaml
-				// if it's part of the same docker-compose project.
-				// The current loop `for _, serviceName := range servicesToDisplay` will only iterate over services
-				// that are either in the config (if len(args)==0) or specified in args AND in config.
-				// Let's adjust to allow displaying a service specified in args even if not in config, if docker returns it.
-				// This means `servicesToDisplay` should just be `args` if `len(args) > 0`.
-				// The "CONFIG SERVICE" column might be misleading then.
-				// For now, sticking to: if args provided, only show those *if they are also in config*.
-				// This makes "CONFIG SERVICE" column meaningful.
-				// If a user *really* wants to see a non-config service, they can use `docker compose ps` directly.
-				// This upctl command is about managing *configured* services.
-				fmt.Printf("Info: Service '%s' specified in 'ps' command is not defined in upctl.yaml configuration or not targeted by this command's scope.\n", argService)
-			}
-		}
-		// If args are provided, we only iterate those that are also in the config.
-		// So, fill servicesToDisplay with elements from args that are in availableServicesFromConfig
+		// If args are provided, we only show those that are also in the config. This keeps the
+		// "CONFIG SERVICE" column meaningful; upctl is about managing *configured* services and
+		// other containers of the project can still be listed with 'docker compose ps'.
 		for _, argService := range args {
 			if availableServicesFromConfig[argService] {
 				servicesToDisplay = append(servicesToDisplay, argService)
+			} else {
+				fmt.Fprintf(os.Stderr, "Info: Service '%s' specified in 'ps' command is not defined in upctl.yaml configuration or not targeted by this command's scope.\n", argService)
 			}
 		}
-		if len(servicesToDisplay) == 0 && len(args) > 0 {
-			// All services specified in args were not in config.
-			// Let docker compose ps handle this; it will likely show nothing or error if those services don't exist.
-			// We can add a message here.
-			// fmt.Println("Info: None of the specified services are defined in the upctl.yaml configuration.")
-			// If CaptureCommand returned an error because docker compose ps found no such services, that's already printed.
-			// If it returned empty JSON, our loop won't run.
-			// The current logic is fine: if `servicesToDisplay` is empty, nothing is printed.
-		}
-
 	} else {
 		for name := range availableServicesFromConfig {
 			servicesToDisplay = append(servicesToDisplay, name)
@@ -161,334 +119,298 @@ func RunDockerComposePs(cmd *cobra.Command, args []string) {
 	}
 	sort.Strings(servicesToDisplay)
 
+	statuses := make([]ServiceStatus, 0, len(servicesToDisplay))
 	for _, serviceName := range servicesToDisplay {
-		details, isRunning := runningServicesDetails[serviceName]
-		statusString := "Not Running"
-		if isRunning {
-			statusString = "Running"
-		}
-
-		if isRunning {
-			var portStrings []string
-			for _, p := range details.Publishers {
-				// Ensure URL is not empty for better display, default to 0.0.0.0 if common
-				url := p.URL
-				if url == "" || url == "::" { // Docker might use "::" for IPv6 all interfaces
-					url = "0.0.0.0"
-				}
-				portStrings = append(portStrings, fmt.Sprintf("%s:%d->%d/%s", url, p.PublishedPort, p.TargetPort, p.Protocol))
-			}
-			portsStr := strings.Join(portStrings, ", ")
-			if len(portsStr) == 0 {
-				portsStr = "-"
-			}
-
-			commandStr := details.Command
-			if len(commandStr) > 20 {
-				commandStr = commandStr[:17] + "..."
-			}
-			if commandStr == "" {
-				commandStr = "-"
-			}
-
-			imageStr := details.Image
-			if len(imageStr) > 24 {
-				imageStr = imageStr[:21] + "..."
-			}
+		details, found := runningServicesDetails[serviceName]
+		statuses = append(statuses, newServiceStatus(serviceName, details, found))
+	}
 
-			psState := details.State
-			if psState == "" {
-				psState = details.Status
-			}
-			if len(psState) > 17 {
-				psState = psState[:14] + "..."
-			}
+	return renderServiceStatuses(os.Stdout, statuses, output, format)
+}
 
-			fmt.Printf("%-16s %-14s %-16s %-26s %-24s %-17s %-19s %s\n",
-				serviceName, statusString, details.Name, imageStr, commandStr,
-				details.Service, psState, portsStr,
-			)
-		} else {
-			// This serviceName is from servicesToDisplay, which means:
-			// 1. No args were given, so it's a service from config, and it's not running.
-			// 2. Args were given, this serviceName was in args AND in config, but it's not running.
-			fmt.Printf("%-16s %-14s %-16s %-26s %-24s %-17s %-19s %s\n",
-				serviceName, statusString, "-", "-", "-", "-", "-", "-",
-			)
+// selectServices validates the services named in args against the configured services
+// and returns them in order without duplicates. Arguments of the form "@group" select
+// the services of a group. It returns nil, meaning every service, when all is set.
+// Unknown names are reported together in one error.
+func selectServices(args []string, all bool) ([]string, error) {
+	if all {
+		return nil, nil
+	}
+	args, err := expandGroups(args)
+	if err != nil {
+		return nil, err
+	}
+	var services, unknown []string
+	seen := make(map[string]bool, len(args))
+	for _, name := range args {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, exists := dockerComposeConfig.Services[name]; !exists {
+			unknown = append(unknown, name)
+			continue
+		}
+		services = append(services, name)
+	}
+	if len(unknown) > 0 {
+		available := make([]string, 0, len(dockerComposeConfig.Services))
+		for name := range dockerComposeConfig.Services {
+			available = append(available, name)
 		}
+		sort.Strings(available)
+		return nil, notFoundError("service(s)", unknown, available)
 	}
+	return services, nil
 }
 
 // RunDockerComposeUp starts docker compose services. It's public so it can be called from other packages.
-func RunDockerComposeUp(cmd *cobra.Command, args []string) {
+func RunDockerComposeUp(cmd *cobra.Command, args []string) error {
 	progress.Start()
 	defer progress.Stop()
 
-	tempComposePath, err := createTempComposeFile()
+	rt, err := projectRuntime()
 	if err != nil {
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
-	fmt.Println("Starting Docker Compose services...")
 	allServices, _ := cmd.Flags().GetBool("all")
-	var composeArgs []string
-	composeArgs = append(composeArgs, "compose", "-f", tempComposePath, "up", "-d")
-	if !allServices && len(args) > 0 {
-		composeArgs = append(composeArgs, args[0])
+	services, err := selectServices(args, allServices)
+	if err != nil {
+		return err
+	}
+	services = withDependencies(services, dockerComposeConfig.Services)
+	if err := ensureRegistryLogin(services); err != nil {
+		return err
 	}
 
-	err = ExecuteCommand("docker", composeArgs...)
-	if err != nil {
-		fmt.Printf("Error starting Docker Compose services: %s\n", err.Error())
-		os.Exit(1)
+	fmt.Println("Starting Docker Compose services...")
+	if err := rt.Start(services); err != nil {
+		return toolError(err, "error starting Docker Compose services")
+	}
+	if wait, timeout := waitFlags(cmd); wait {
+		if err := waitForServices(rt, services, timeout); err != nil {
+			return err
+		}
 	}
 	fmt.Println("Docker Compose services started successfully")
+	return nil
 }
 
-// RunDockerComposeDown stops Docker Compose services.
-func RunDockerComposeDown(cmd *cobra.Command, args []string) {
+// RunDockerComposeDown stops Docker Compose services. With --all the whole project
+// is torn down, including its volumes with --volumes. Otherwise only the containers
+// of the named services are stopped and removed, together with the services that
+// depend on them when --cascade is set. The plan is printed before acting.
+func RunDockerComposeDown(cmd *cobra.Command, args []string) error {
 	progress.Start()
 	defer progress.Stop()
 
-	tempComposePath, err := createTempComposeFile()
+	rt, err := projectRuntime()
 	if err != nil {
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
-	fmt.Println("Stopping Docker Compose services...")
 	allServices, _ := cmd.Flags().GetBool("all")
-	composeArgs := []string{"compose", "-f", tempComposePath, "down"}
-	if !allServices && len(args) > 0 {
-		composeArgs = append(composeArgs, args[0])
+	cascade, _ := cmd.Flags().GetBool("cascade")
+	volumes, _ := cmd.Flags().GetBool("volumes")
+	if allServices {
+		if cascade {
+			return usageError("--cascade cannot be used with --all")
+		}
+		if volumes {
+			fmt.Println("Plan: tear down the whole project and remove its volumes")
+		} else {
+			fmt.Println("Plan: tear down the whole project (volumes are kept)")
+		}
+		if err := rt.Down(volumes); err != nil {
+			return toolError(err, "error stopping Docker Compose services")
+		}
+		fmt.Println("Docker Compose services stopped successfully")
+		return nil
+	}
+	if volumes {
+		return usageError("--volumes can only be used with --all")
 	}
 
-	err = ExecuteCommand("docker", composeArgs...)
+	services, err := selectServices(args, false)
 	if err != nil {
-		fmt.Printf("Error stopping Docker Compose services: %s\n", err.Error())
-		os.Exit(1)
+		return err
+	}
+
+	// Order the services so that dependents are stopped before what they depend on.
+	requested := make(map[string]bool, len(services))
+	for _, name := range services {
+		requested[name] = true
+	}
+	var targets, leftRunning []string
+	for _, name := range withDependents(services, dockerComposeConfig.Services) {
+		if cascade || requested[name] {
+			targets = append(targets, name)
+		} else {
+			leftRunning = append(leftRunning, name)
+		}
+	}
+
+	fmt.Printf("Plan: stop and remove %s\n", strings.Join(targets, ", "))
+	if len(leftRunning) > 0 {
+		fmt.Printf("Note: %s depend(s) on the selected services and will not be stopped; use --cascade to stop them too\n", strings.Join(leftRunning, ", "))
+	}
+	if err := rt.Remove(targets); err != nil {
+		return toolError(err, "error stopping Docker Compose services")
 	}
 	fmt.Println("Docker Compose services stopped successfully")
+	return nil
 }
 
 // RunDockerComposeInstall handles the installation of specific or all services.
-func RunDockerComposeInstall(cmd *cobra.Command, args []string) {
+func RunDockerComposeInstall(cmd *cobra.Command, args []string) error {
 	progress.Start()
 	defer progress.Stop()
 
 	installAll, _ := cmd.Flags().GetBool("all")
 	if !(len(args) > 0 || installAll) {
-		fmt.Println("Please provide a service name or --all flag")
-		os.Exit(1)
+		return usageError("please provide a service name or --all flag")
 	}
 
-	tempComposePath, err := createTempComposeFile()
+	rt, err := projectRuntime()
 	if err != nil {
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
-	err = viper.Unmarshal(&dockerComposeConfig)
+	services, err := selectServices(args, installAll)
 	if err != nil {
-		fmt.Printf("Error loading docker compose config: %s\n", err.Error())
-		os.Exit(1)
+		return err
+	}
+	services = withDependencies(services, dockerComposeConfig.Services)
+	if err := ensureRegistryLogin(services); err != nil {
+		return err
 	}
 
-	if len(args) > 0 {
-		serviceName := args[0]
-		if _, exists := dockerComposeConfig.Services[serviceName]; !exists {
-			fmt.Printf("Service '%s' not found in configuration\n", serviceName)
-			os.Exit(1)
-		}
-		fmt.Printf("Installing and starting service: %s\n", serviceName)
-		err = ExecuteCommand("docker", "compose", "-f", tempComposePath, "up", "-d", serviceName)
-		if err != nil {
-			fmt.Printf("Error installing service %s: %s\n", serviceName, err.Error())
-			os.Exit(1)
-		}
-		fmt.Printf("Service %s installed and started successfully\n", serviceName)
-	} else if installAll {
+	if len(services) > 0 {
+		fmt.Printf("Installing and starting service(s): %s\n", strings.Join(services, ", "))
+	} else {
 		fmt.Println("Installing and starting all services...")
-		err = ExecuteCommand("docker", "compose", "-f", tempComposePath, "up", "-d")
-		if err != nil {
-			fmt.Printf("Error installing all services: %s\n", err.Error())
-			os.Exit(1)
+	}
+	if err := rt.Start(services); err != nil {
+		return toolError(err, "error installing service(s)")
+	}
+	if wait, timeout := waitFlags(cmd); wait {
+		if err := waitForServices(rt, services, timeout); err != nil {
+			return err
 		}
+	}
+	if len(services) > 0 {
+		fmt.Printf("Service(s) %s installed and started successfully\n", strings.Join(services, ", "))
+	} else {
 		fmt.Println("All services installed and started successfully")
 	}
+	return nil
 }
 
-// RunDockerComposeLogs shows logs for one or all services.
-func RunDockerComposeLogs(cmd *cobra.Command, args []string) {
-	tempComposePath, err := createTempComposeFile()
+// RunDockerComposeLogs shows logs for one or more services, or all services.
+func RunDockerComposeLogs(cmd *cobra.Command, args []string) error {
+	rt, err := projectRuntime()
 	if err != nil {
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
 	allServicesLogs, _ := cmd.Flags().GetBool("all")
-	var logArgs []string
-	logArgs = append(logArgs, "compose", "-f", tempComposePath, "logs", "--follow")
-	if !allServicesLogs && len(args) > 0 {
-		logArgs = append(logArgs, args[0])
+	services, err := selectServices(args, allServicesLogs)
+	if err != nil {
+		return err
 	}
 
-	err = ExecuteCommand("docker", logArgs...)
-	if err != nil {
-		fmt.Printf("Error showing logs: %s\n", err.Error())
-		os.Exit(1)
+	if err := rt.Logs(services, true); err != nil {
+		return toolError(err, "error showing logs")
 	}
+	return nil
 }
 
-// RunDockerImportDB handles importing a database into a Docker MySQL container.
-func RunDockerImportDB(cmd *cobra.Command, args []string) {
+// RunDockerImportDB imports the dumps of the requested database targets, or of all
+// of them with --all. Each dump is streamed into the database client inside the
+// target's container, decompressing .gz, .bz2 and .zst dumps on the fly, so nothing
+// is copied into the container. Targets in different containers are imported in parallel.
+func RunDockerImportDB(cmd *cobra.Command, args []string) error {
 	progress.Start()
 	defer progress.Stop()
 
-	tempComposePath, err := createTempComposeFile()
+	all, _ := cmd.Flags().GetBool("all")
+	targets, err := selectDatabaseTargets(args, all)
 	if err != nil {
-		fmt.Printf("Error creating temporary compose file: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	defer os.Remove(tempComposePath)
 
-	fmt.Println("Ensuring MySQL service is running...")
-	err = ExecuteCommand("docker", "compose", "-f", tempComposePath, "up", "-d", "mysql")
+	rt, err := projectRuntime()
 	if err != nil {
-		fmt.Printf("Error starting MySQL service: %s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-
-	dbFilePath := cleanPath(mysqlConfig.DBFile)
-	if _, err := os.Stat(dbFilePath); os.IsNotExist(err) {
-		fmt.Println("Downloading database...")
-		path, errPath := exec.LookPath("tsh")
-		if errPath != nil {
-			fmt.Println("Error finding tsh:", errPath)
-			os.Exit(1)
-		}
-		fmt.Println("Authenticating with Teleport...")
-		if errAuth := ExecuteCommand(path, "login", fmt.Sprintf("--proxy=%s", teleportConfig.Host)); errAuth != nil {
-			fmt.Println("Error authenticating with Teleport:", errAuth)
-			os.Exit(2)
-		}
-		fmt.Println("Authenticating with AWS...")
-		if errAwsAuth := ExecuteCommand(path, "apps", "login", teleportConfig.AWSApp, "--aws-role", teleportConfig.AWSRole); errAwsAuth != nil {
-			fmt.Println("Error authenticating with AWS:", errAwsAuth)
-			os.Exit(2)
-		}
-		if errS3 := ExecuteCommand("tsh", "aws", "--app", teleportConfig.AWSApp, "s3", "cp",
-			fmt.Sprintf("s3://%s/%s", mysqlConfig.S3Bucket, mysqlConfig.S3Key), dbFilePath,
-			"--region", mysqlConfig.S3Region); errS3 != nil {
-			fmt.Println("Error downloading database:", errS3)
-			os.Exit(2)
-		}
+	if err := checkDatabaseServices(targets); err != nil {
+		return err
 	}
 
-	fmt.Println("Getting MySQL container ID...")
-	containerIDCmd := exec.Command("docker", "compose", "-f", tempComposePath, "ps", "-q", "mysql")
-	containerIDBytes, err := containerIDCmd.Output()
-	if err != nil {
-		fmt.Printf("Error getting MySQL container ID: %s\n", err.Error())
-		os.Exit(1)
+	var services []string
+	for _, target := range targets {
+		if !contains(services, target.Service) {
+			services = append(services, target.Service)
+		}
 	}
-	containerID := strings.TrimSpace(string(containerIDBytes))
-	if containerID == "" {
-		fmt.Println("Error: MySQL container not found")
-		os.Exit(1)
+	fmt.Printf("Ensuring database service(s) %s are running...\n", strings.Join(services, ", "))
+	if err := rt.Start(services); err != nil {
+		return toolError(err, "error starting database services")
 	}
 
-	fmt.Println("Copying database file to container...")
-	tmpPath := "/tmp/import.sql"
-	err = ExecuteCommand("docker", "cp", dbFilePath, containerID+":"+tmpPath)
-	if err != nil {
-		fmt.Printf("Error copying database file to container: %s\n", err.Error())
-		os.Exit(1)
+	// Fetching may need an interactive Teleport login, so dumps are fetched one at a time.
+	refresh, _ := cmd.Flags().GetBool("refresh")
+	session := &teleportSession{}
+	dumps := make(map[string]string, len(targets))
+	for _, target := range targets {
+		dbFilePath, err := resolveDump(target, session, refresh)
+		if err != nil {
+			return err
+		}
+		dumps[target.Name] = dbFilePath
 	}
 
-	fmt.Println("Importing database...")
-	importCmdStr := fmt.Sprintf("mysql -u %s -p%s %s < %s",
-		mysqlConfig.User, mysqlConfig.Password, mysqlConfig.Database, tmpPath)
-	err = ExecuteCommand("docker", "exec", containerID, "bash", "-c", importCmdStr)
-	if err != nil {
-		fmt.Printf("Error importing database: %s\n", err.Error())
-		os.Exit(1)
+	for _, service := range services {
+		if _, err := rt.ContainerID(service); err != nil {
+			return toolError(err, "container of service '%s' not found", service)
+		}
 	}
 
-	fmt.Println("Cleaning up...")
-	err = ExecuteCommand("docker", "exec", containerID, "rm", tmpPath)
-	if err != nil {
-		fmt.Printf("Error cleaning up: %s\n", err.Error())
+	if err := importDatabases(rt, targets, dumps); err != nil {
+		return err
 	}
 	fmt.Println("Database imported successfully")
+	return nil
 }
 
-func createTempComposeFile() (string, error) {
-	err := viper.Unmarshal(&dockerComposeConfig)
-	if err != nil {
-		if dockerComposeConfig.Services == nil {
-			dockerComposeConfig.Services = make(map[string]interface{})
-		}
-		if dockerComposeConfig.Volumes == nil {
-			dockerComposeConfig.Volumes = make(map[string]interface{})
-		}
-		if dockerComposeConfig.Networks == nil {
-			dockerComposeConfig.Networks = make(map[string]interface{})
-		}
-	}
-
-	if viper.IsSet("services") {
-		servicesData := viper.Get("services")
-		if servicesMap, ok := servicesData.(map[string]interface{}); ok {
-			dockerComposeConfig.Services = servicesMap
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: 'services' key in upctl.yaml is not in the expected map[string]interface{} format.\n")
-		}
-	}
-	if viper.IsSet("volumes") {
-		volumesData := viper.Get("volumes")
-		if volumesMap, ok := volumesData.(map[string]interface{}); ok {
-			dockerComposeConfig.Volumes = volumesMap
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: 'volumes' key in upctl.yaml is not in the expected map[string]interface{} format.\n")
-		}
-	}
-	if viper.IsSet("networks") {
-		networksData := viper.Get("networks")
-		if networksMap, ok := networksData.(map[string]interface{}); ok {
-			dockerComposeConfig.Networks = networksMap
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: 'networks' key in upctl.yaml is not in the expected map[string]interface{} format.\n")
-		}
-	}
-
-	tempFile, err := os.CreateTemp("", "docker-compose-*.yml")
+// writeComposeFile renders the services, volumes and networks from upctl.yaml into
+// the project's state directory (~/.upctl/state/<project>/docker-compose.yml) and
+// returns its path. The file is kept between invocations so that every command
+// talks to the same Compose project; it is only rewritten when the rendered
+// content changes.
+func writeComposeFile() (string, error) {
+	cfg, err := loadComposeConfig()
 	if err != nil {
-		return "", fmt.Errorf("error creating temporary file: %s", err.Error())
+		return "", err
 	}
-	// It's important to close the file descriptor, but do it after writing.
-	// The path is still valid after closing.
+	dockerComposeConfig = cfg
+	dockerComposeConfig.Name = projectName()
 
 	yamlData, err := yaml.Marshal(dockerComposeConfig)
 	if err != nil {
-		tempFile.Close() // Close before returning on error
 		return "", fmt.Errorf("error marshaling config to YAML: %s", err.Error())
 	}
 
-	if _, err := tempFile.Write(yamlData); err != nil {
-		tempFile.Close() // Close before returning on error
-		return "", fmt.Errorf("error writing to temporary file: %s", err.Error())
+	stateDir, err := projectStateDir()
+	if err != nil {
+		return "", err
 	}
 
-	filePath := tempFile.Name()              // Get the name before closing
-	if err := tempFile.Close(); err != nil { // Now close
-		// Log or handle error, but filePath is still valid for defer os.Remove
-		fmt.Fprintf(os.Stderr, "Warning: error closing temporary compose file '%s': %v\n", filePath, err)
+	filePath := filepath.Join(stateDir, composeFileName)
+	// Only upctl and Docker Compose need to read it.
+	if _, err := writeFileIfChanged(filePath, yamlData, 0600); err != nil {
+		return "", fmt.Errorf("error writing compose file '%s': %s", filePath, err.Error())
 	}
 
 	return filePath, nil
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -81,6 +82,11 @@ func setup(t *testing.T) {
 	mockCaptureCommandShouldError = false
 	mockCaptureCommandOutput = ""
 
+	t.Setenv("UPCTL_HOME", t.TempDir()) // Keep rendered compose files out of the real home directory
+	if progress == nil {
+		progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
+	}
+
 	previousCfgFileValue := cfgFile
 	previousSkipConfigReload := skipConfigReload
 	skipConfigReload = true // Prevent initConfig from overriding test config
@@ -231,6 +237,24 @@ func TestRunDockerComposeUp_AllAndService(t *testing.T) {
 	}
 }
 
+func TestInstall_AllAndService(t *testing.T) {
+	setup(t)
+	defer teardown()
+	installCmd.Flags().Set("all", "true")
+	defer installCmd.Flags().Set("all", "false")
+
+	err := installCmd.RunE(installCmd, []string{"service1"})
+	if ExitCode(err) != ExitUsage {
+		t.Fatalf("Expected a usage error for 'install --all service1', got %v", err)
+	}
+	if !strings.Contains(err.Error(), "cannot specify service names when the --all flag is used for 'install'") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if mockExecuteCmdInfo.Calls > 0 {
+		t.Errorf("ExecuteCommand should not have been called, but was called %d times", mockExecuteCmdInfo.Calls)
+	}
+}
+
 func equalSlices(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -247,7 +271,8 @@ func equalSlices(a, b []string) bool {
 // It takes *testing.T to ensure test-specific setup (like OnInitialize) is fresh.
 func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 	testRootCmd := &cobra.Command{Use: "upctl"}
-	testRootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.upctl.yaml)")
+	// Default to the file written by setup(); defining the flag would otherwise reset cfgFile.
+	testRootCmd.PersistentFlags().StringVar(&cfgFile, "config", cfgFile, "config file (default is $HOME/.upctl.yaml)")
 
 	// Override OnInitialize to use the test config
 	cobra.OnInitialize(func() {
@@ -265,7 +290,7 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 
 	// Add commands needed for tests
 	var testUpCmd = &cobra.Command{
-		Use: "up [service]", Short: "Start specified or all services", Args: cobra.ArbitraryArgs,
+		Use: "up [service...]", Short: "Start specified or all services", Args: cobra.ArbitraryArgs,
 		RunE: func(ccmd *cobra.Command, args []string) error {
 			allServices, _ := ccmd.Flags().GetBool("all")
 			numArgs := len(args)
@@ -277,22 +302,19 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 				if numArgs == 0 {
 					return fmt.Errorf("you must specify a service name or use the --all flag")
 				}
-				if numArgs > 1 {
-					return fmt.Errorf("too many arguments, expected 1 service name or --all flag (got %d)", numArgs)
-				}
 			}
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
 			}
-			RunDockerComposeUp(ccmd, args)
-			return nil
+			return RunDockerComposeUp(ccmd, args)
 		},
 	}
 	testUpCmd.Flags().BoolP("all", "a", false, "Start all services")
+	addWaitFlags(testUpCmd)
 	testRootCmd.AddCommand(testUpCmd)
 
 	var testDownCmd = &cobra.Command{
-		Use: "down [service]", Short: "Stop Docker Compose services", Args: cobra.ArbitraryArgs,
+		Use: "down [service...]", Short: "Stop Docker Compose services", Args: cobra.ArbitraryArgs,
 		RunE: func(ccmd *cobra.Command, args []string) error {
 			allServices, _ := ccmd.Flags().GetBool("all")
 			numArgs := len(args)
@@ -304,22 +326,20 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 				if numArgs == 0 {
 					return fmt.Errorf("you must specify a service name or use the --all flag for 'down'")
 				}
-				if numArgs > 1 {
-					return fmt.Errorf("too many arguments to 'down', expected 1 service name or --all flag (got %d)", numArgs)
-				}
 			}
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
 			}
-			RunDockerComposeDown(ccmd, args)
-			return nil
+			return RunDockerComposeDown(ccmd, args)
 		},
 	}
 	testDownCmd.Flags().BoolP("all", "a", false, "Stop all services")
+	testDownCmd.Flags().Bool("cascade", false, "Also stop dependent services")
+	testDownCmd.Flags().Bool("volumes", false, "Remove volumes")
 	testRootCmd.AddCommand(testDownCmd)
 
 	var testLogsCmd = &cobra.Command{
-		Use: "logs [service]", Short: "Show logs for services", Args: cobra.ArbitraryArgs,
+		Use: "logs [service...]", Short: "Show logs for services", Args: cobra.ArbitraryArgs,
 		RunE: func(ccmd *cobra.Command, args []string) error {
 			allServices, _ := ccmd.Flags().GetBool("all")
 			numArgs := len(args)
@@ -331,15 +351,11 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 				if numArgs == 0 {
 					return fmt.Errorf("you must specify a service name or use the --all flag for 'logs'")
 				}
-				if numArgs > 1 {
-					return fmt.Errorf("too many arguments to 'logs', expected 1 service name or --all flag (got %d)", numArgs)
-				}
 			}
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
 			}
-			RunDockerComposeLogs(ccmd, args)
-			return nil
+			return RunDockerComposeLogs(ccmd, args)
 		},
 	}
 	testLogsCmd.Flags().BoolP("all", "a", false, "Get logs for all services")
@@ -347,11 +363,11 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 
 	var testPsCmd = &cobra.Command{
 		Use: "ps [service...]", Short: "List running services and all available services from config", Args: cobra.ArbitraryArgs,
-		Run: func(ccmd *cobra.Command, args []string) {
+		RunE: func(ccmd *cobra.Command, args []string) error {
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
 			}
-			RunDockerComposePs(ccmd, args)
+			return RunDockerComposePs(ccmd, args)
 		},
 	}
 	testRootCmd.AddCommand(testPsCmd)
@@ -359,7 +375,7 @@ func InitializeTestCmd(t *testing.T) (*cobra.Command, error) {
 	return testRootCmd, nil
 }
 
-func TestCreateTempComposeFile_NoVersionKey(t *testing.T) {
+func TestWriteComposeFile_NoVersionKey(t *testing.T) {
 	setup(t) // This sets up viper with mockYAMLConfig
 	defer teardown()
 
@@ -374,16 +390,15 @@ func TestCreateTempComposeFile_NoVersionKey(t *testing.T) {
 	// setup(t) should have handled this by calling initConfig via OnInitialize
 	// when executeCommandCobra runs, or if RunDockerComposePs is called directly,
 	// it unmarshals viper.
-	// For a direct test of createTempComposeFile, we need to ensure dockerComposeConfig is populated.
+	// For a direct test of writeComposeFile, we need to ensure dockerComposeConfig is populated.
 	if err := viper.Unmarshal(&dockerComposeConfig); err != nil {
-		t.Fatalf("Failed to unmarshal mock config into dockerComposeConfig for TestCreateTempComposeFile: %v", err)
+		t.Fatalf("Failed to unmarshal mock config into dockerComposeConfig for TestWriteComposeFile: %v", err)
 	}
 
-	tempFilePath, err := createTempComposeFile()
+	tempFilePath, err := writeComposeFile()
 	if err != nil {
-		t.Fatalf("createTempComposeFile() returned an error: %v", err)
+		t.Fatalf("writeComposeFile() returned an error: %v", err)
 	}
-	defer os.Remove(tempFilePath)
 
 	generatedYAMLBytes, errR := os.ReadFile(tempFilePath)
 	if errR != nil {
@@ -459,12 +474,12 @@ func TestRunDockerComposeDown_SpecificService(t *testing.T) {
 		t.Error("ExecuteCommand was not called for 'down service1'")
 	} else {
 		expectedArgsPrefix := []string{"compose", "-f"}
-		expectedArgsSuffix := []string{"down", "service1"}
+		// Only the requested service is stopped and removed; 'down' would tear down the whole project.
+		expectedArgsSuffix := []string{"rm", "--stop", "--force", "service1"}
 		if !(mockExecuteCmdInfo.Command == "docker" &&
 			equalSlices(mockExecuteCmdInfo.Args[:2], expectedArgsPrefix) &&
-			equalSlices(mockExecuteCmdInfo.Args[3:5], expectedArgsSuffix) &&
-			len(mockExecuteCmdInfo.Args) == 5) {
-			t.Errorf("Expected 'docker compose -f <file> down service1', got command '%s' with args %v", mockExecuteCmdInfo.Command, mockExecuteCmdInfo.Args)
+			equalSlices(mockExecuteCmdInfo.Args[3:], expectedArgsSuffix)) {
+			t.Errorf("Expected 'docker compose -f <file> rm --stop --force service1', got command '%s' with args %v", mockExecuteCmdInfo.Command, mockExecuteCmdInfo.Args)
 		}
 	}
 }
@@ -530,8 +545,9 @@ func TestRunDockerComposePs_CombinedOutput_JSON(t *testing.T) {
 	}
 
 	// Check service1 (running)
-	// Example: service1         Running        project_service1_1 nginx:latest             nginx -g                 service1          running             0.0.0.0:8080->80/tcp
-	if !strings.Contains(output, "service1         Running") {
+	// Example: service1             Running       project_service1_1   nginx:latest   nginx -g   running   0.0.0.0:8080->80/tcp
+	// Column widths follow the data, so match on the separating whitespace rather than exact padding.
+	if !regexp.MustCompile(`(?m)^service1\s+Running\s`).MatchString(output) {
 		t.Errorf("Expected 'service1' to be 'Running'. Output:\n%s", output)
 	}
 	if !strings.Contains(output, "project_service1_1") || !strings.Contains(output, "nginx:latest") || !strings.Contains(output, "0.0.0.0:8080->80/tcp") {
@@ -539,11 +555,11 @@ func TestRunDockerComposePs_CombinedOutput_JSON(t *testing.T) {
 	}
 
 	// Check service2 (configured, but not in mock JSON ps output -> Not Running)
-	if !strings.Contains(output, "service2         Not Running") {
+	if !regexp.MustCompile(`(?m)^service2\s+Not Running\s`).MatchString(output) {
 		t.Errorf("Expected 'service2' to be 'Not Running'. Output:\n%s", output)
 	}
 	// For "Not Running" services, other fields should be placeholders like "-"
-	if !strings.Contains(output, "service2         Not Running    -                  -                          -                        -                 -                   -") {
+	if !regexp.MustCompile(`(?m)^service2\s+Not Running(\s+-){6}$`).MatchString(output) {
 		// t.Errorf("Expected placeholder details for 'Not Running' service2. Output:\n%s", output)
 	}
 
@@ -575,15 +591,16 @@ func TestRunDockerComposePs_CombinedOutput_JSON(t *testing.T) {
 	if mockCaptureCmdInfo.Calls == 0 {
 		t.Error("CaptureCommand was not called for 'ps'")
 	} else {
-		if len(mockCaptureCmdInfo.Args) < 5 { // docker compose -f <file> ps --format json
-			t.Fatalf("CaptureCommand called with too few arguments for ps --format json: %v", mockCaptureCmdInfo.Args)
+		if len(mockCaptureCmdInfo.Args) < 7 { // docker compose -f <file> ps --format json --all
+			t.Fatalf("CaptureCommand called with too few arguments for ps --format json --all: %v", mockCaptureCmdInfo.Args)
 		}
-		expectedFormatFlagIndex := len(mockCaptureCmdInfo.Args) - 2
+		expectedFormatFlagIndex := len(mockCaptureCmdInfo.Args) - 3
 		if !(mockCaptureCmdInfo.Command == "docker" &&
 			mockCaptureCmdInfo.Args[0] == "compose" && mockCaptureCmdInfo.Args[1] == "-f" && /* Args[2] is tempfile */
 			mockCaptureCmdInfo.Args[3] == "ps" &&
-			mockCaptureCmdInfo.Args[expectedFormatFlagIndex] == "--format" && mockCaptureCmdInfo.Args[expectedFormatFlagIndex+1] == "json") {
-			t.Errorf("Expected 'docker compose -f <file> ps --format json', got command '%s' with args %v", mockCaptureCmdInfo.Command, mockCaptureCmdInfo.Args)
+			mockCaptureCmdInfo.Args[expectedFormatFlagIndex] == "--format" && mockCaptureCmdInfo.Args[expectedFormatFlagIndex+1] == "json" &&
+			mockCaptureCmdInfo.Args[expectedFormatFlagIndex+2] == "--all") {
+			t.Errorf("Expected 'docker compose -f <file> ps --format json --all', got command '%s' with args %v", mockCaptureCmdInfo.Command, mockCaptureCmdInfo.Args)
 		}
 	}
 }
@@ -660,3 +677,122 @@ func TestRunDockerComposePs_SpecificService_JSON(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteComposeFile_StableProjectFile(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	viper.SetConfigFile(cfgFile)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read test config: %v", err)
+	}
+	viper.Set("project", "myproject")
+
+	firstPath, err := writeComposeFile()
+	if err != nil {
+		t.Fatalf("writeComposeFile() returned an error: %v", err)
+	}
+	expectedPath := filepath.Join(os.Getenv("UPCTL_HOME"), "state", "myproject", composeFileName)
+	if firstPath != expectedPath {
+		t.Errorf("Expected compose file at '%s', got '%s'", expectedPath, firstPath)
+	}
+
+	var generatedContent map[string]interface{}
+	data, _ := os.ReadFile(firstPath)
+	if err := yaml.Unmarshal(data, &generatedContent); err != nil {
+		t.Fatalf("Failed to unmarshal generated YAML content: %v", err)
+	}
+	if generatedContent["name"] != "myproject" {
+		t.Errorf("Expected project name 'myproject' in compose file, got %v", generatedContent["name"])
+	}
+
+	// An unchanged config must not rewrite the file.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(firstPath, past, past); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+	secondPath, err := writeComposeFile()
+	if err != nil {
+		t.Fatalf("writeComposeFile() returned an error on second call: %v", err)
+	}
+	if secondPath != firstPath {
+		t.Errorf("Expected the same compose file path, got '%s' and '%s'", firstPath, secondPath)
+	}
+	info, err := os.Stat(secondPath)
+	if err != nil {
+		t.Fatalf("Compose file was removed after second call: %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("Compose file was rewritten although its content did not change")
+	}
+
+	// A changed config rewrites it.
+	viper.Set("services.service3", map[string]interface{}{"image": "busybox"})
+	if _, err := writeComposeFile(); err != nil {
+		t.Fatalf("writeComposeFile() returned an error on third call: %v", err)
+	}
+	data, _ = os.ReadFile(firstPath)
+	if !strings.Contains(string(data), "service3") {
+		t.Errorf("Expected compose file to be rewritten with service3, got:\n%s", data)
+	}
+}
+
+func TestRunDockerComposeUp_MultipleServices(t *testing.T) {
+	setup(t)
+	defer teardown()
+	rt := &fakeRuntime{}
+	useFakeRuntime(t, rt)
+
+	testRootCmd, _ := InitializeTestCmd(t)
+	if _, err := executeCommandCobra(testRootCmd, "up", "service2", "service1", "service2"); err != nil {
+		t.Fatalf("up service2 service1 failed: %v", err)
+	}
+	if len(rt.calls) != 1 || !equalSlices(rt.services[0], []string{"service2", "service1"}) {
+		t.Errorf("Expected one start call for service2 and service1, got calls %v with services %v", rt.calls, rt.services)
+	}
+}
+
+func TestRunDockerComposeDown_UnknownServices(t *testing.T) {
+	setup(t)
+	defer teardown()
+	rt := &fakeRuntime{}
+	useFakeRuntime(t, rt)
+
+	testRootCmd, _ := InitializeTestCmd(t)
+	_, err := executeCommandCobra(testRootCmd, "down", "service1", "nope", "missing")
+	if ExitCode(err) != ExitServiceNotFound {
+		t.Fatalf("Expected exit code %d, got %d (%v)", ExitServiceNotFound, ExitCode(err), err)
+	}
+	if !strings.Contains(err.Error(), "nope, missing") || !strings.Contains(err.Error(), "available: service1, service2, service_no_details") {
+		t.Errorf("Expected all unknown and available services in the error, got %v", err)
+	}
+	if len(rt.calls) != 0 {
+		t.Errorf("Runtime should not be called when a service is unknown, got calls %v", rt.calls)
+	}
+}
+
+func TestProjectStateDir_RejectsUnsafeNames(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	for _, name := range []string{"../x", "a/b", ".", "..", "my project", "MyProject", "app.v1", "-app", "_app"} {
+		viper.Set("project", name)
+		if _, err := projectStateDir(); err == nil || ExitCode(err) != ExitConfig {
+			t.Errorf("Expected a config error for project '%s', got %v", name, err)
+		}
+		if _, err := snapshotDir(DatabaseTarget{Name: "db"}); err == nil {
+			t.Errorf("Expected snapshotDir to reject project '%s'", name)
+		}
+	}
+	viper.Set("project", "my-project_1")
+	if _, err := projectStateDir(); err != nil {
+		t.Errorf("Expected project 'my-project_1' to be accepted, got %v", err)
+	}
+	entries, _ := os.ReadDir(os.Getenv("UPCTL_HOME"))
+	for _, entry := range entries {
+		if entry.Name() != "state" {
+			t.Errorf("Expected nothing but the state directory in UPCTL_HOME, found %s", entry.Name())
+		}
+	}
+}
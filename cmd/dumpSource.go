@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ways of reaching an s3:// dump source.
+const (
+	viaTeleport = "teleport"
+	viaAWS      = "aws"
+)
+
+// DumpSourceConfig is the 'source' of a database target: where its dump comes from.
+// Exactly one of URL and Command is set. URL is an s3:// or http(s):// URL, or a
+// local path; Command is a shell command whose standard output is the dump.
+type DumpSourceConfig struct {
+	URL     string `mapstructure:"url"`
+	Region  string `mapstructure:"region"`
+	Via     string `mapstructure:"via"`
+	Command string `mapstructure:"command"`
+}
+
+// sourceInfo describes the dump currently at a source.
+type sourceInfo struct {
+	// version identifies the dump, such as its ETag; "" when the source can't tell.
+	version string
+	// size is the dump's size in bytes, or -1 when unknown.
+	size int64
+}
+
+// dumpSource fetches the dump of a database target.
+type dumpSource interface {
+	// String identifies the source in messages and in the cache metadata.
+	String() string
+	// fileName is the name the dump is cached under; its extension tells how the
+	// dump is compressed.
+	fileName() string
+	// check returns the version and size of the dump currently at the source.
+	check() (sourceInfo, error)
+	// fetch writes the dump to w.
+	fetch(w io.Writer) error
+}
+
+// dumpSourceFor returns the source of a target's dump, or nil when the dump is a
+// local file. Targets without a 'source' fall back to the s3_* fields, so older
+// configurations keep downloading through Teleport.
+func dumpSourceFor(target DatabaseTarget, session *teleportSession) (dumpSource, error) {
+	cfg := target.Source
+	if cfg.URL == "" && cfg.Command == "" && target.S3Bucket != "" {
+		cfg = DumpSourceConfig{
+			URL:    fmt.Sprintf("s3://%s/%s", target.S3Bucket, target.S3Key),
+			Region: target.S3Region,
+			Via:    viaTeleport,
+		}
+	}
+	if cfg.URL != "" && cfg.Command != "" {
+		return nil, configError(nil, "database '%s' has both a source url and a source command", target.Name)
+	}
+	if cfg.Command != "" {
+		name := "dump.sql"
+		if target.DBFile != "" {
+			name = filepath.Base(target.DBFile)
+		}
+		return commandSource{command: cfg.Command, name: name}, nil
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil || cfg.URL == "" {
+		return nil, nil
+	}
+	switch u.Scheme {
+	case "s3":
+		via := cfg.Via
+		if via == "" {
+			via = viaTeleport
+		}
+		if via != viaTeleport && via != viaAWS {
+			return nil, configError(nil, "database '%s' has unsupported source via '%s'; use '%s' or '%s'", target.Name, via, viaTeleport, viaAWS)
+		}
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, configError(nil, "database '%s' has invalid source url '%s'; use s3://<bucket>/<key>", target.Name, cfg.URL)
+		}
+		return &s3Source{bucket: u.Host, key: strings.TrimPrefix(u.Path, "/"), region: cfg.Region, via: via, session: session}, nil
+	case "http", "https":
+		return httpSource{url: cfg.URL, name: path.Base(u.Path)}, nil
+	case "", "file":
+		return nil, nil
+	}
+	return nil, configError(nil, "database '%s' has unsupported source url '%s'", target.Name, cfg.URL)
+}
+
+// localDumpPath returns the local file a target's dump is read from when it has no
+// remote source: the source path, or db_file.
+func localDumpPath(target DatabaseTarget) (string, error) {
+	path := target.DBFile
+	if target.Source.URL != "" {
+		path = strings.TrimPrefix(target.Source.URL, "file://")
+	}
+	if path == "" {
+		return "", configError(nil, "database '%s' has neither a db_file nor a source", target.Name)
+	}
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return "", configError(err, "invalid dump path '%s' for database '%s'", path, target.Name)
+	}
+	return cleaned, nil
+}
+
+// resolveDump returns the local path of a target's dump. Dumps from a remote source
+// are kept in the dump cache and fetched again when refresh is set, when the source
+// holds a newer version, or when the cached file fails verification. Sources that
+// can't tell their version, such as commands, are fetched every time. When the
+// source can't be reached a verified cached dump is used with a warning.
+func resolveDump(target DatabaseTarget, session *teleportSession, refresh bool) (string, error) {
+	source, err := dumpSourceFor(target, session)
+	if err != nil {
+		return "", err
+	}
+	if source == nil {
+		return localDumpPath(target)
+	}
+	path, err := cachedDumpPath(target, source)
+	if err != nil {
+		return "", err
+	}
+
+	meta, metaErr := readDumpMeta(path)
+	cached := metaErr == nil && meta.Source == source.String()
+	info, checkErr := source.check()
+	if cached && !refresh {
+		switch {
+		case checkErr != nil:
+			fmt.Fprintf(os.Stderr, "Warning: could not check %s (%s); using the cached dump\n", source, checkErr)
+			if err := verifyDump(path, meta); err != nil {
+				return "", toolError(err, "the cached dump of database '%s' is damaged and its source can't be reached", target.Name)
+			}
+			return path, nil
+		case info.version != "" && info.version == meta.Version:
+			err := verifyDump(path, meta)
+			if err == nil {
+				fmt.Printf("Dump of database %s is up to date\n", target.Name)
+				return path, nil
+			}
+			fmt.Fprintf(os.Stderr, "Warning: the cached dump of database %s is damaged (%s); fetching it again\n", target.Name, err)
+		}
+	}
+	if checkErr != nil {
+		return "", toolError(checkErr, "error checking the dump of database '%s' at %s", target.Name, source)
+	}
+
+	fmt.Printf("Fetching the dump of database %s from %s...\n", target.Name, source)
+	meta, err = fetchDump(source, info, path)
+	if err != nil {
+		return "", toolError(err, "error fetching the dump of database '%s'", target.Name)
+	}
+	if err := writeDumpMeta(path, meta); err != nil {
+		return "", fmt.Errorf("error recording the cached dump '%s': %w", path, err)
+	}
+	return path, nil
+}
+
+// fetchDump writes a source's dump to a '.part' file next to path and only renames
+// it once complete, so that an interrupted fetch is never mistaken for a dump. A
+// dump that is shorter or longer than the source announced is rejected. It returns
+// the metadata of the fetched dump.
+func fetchDump(source dumpSource, info sourceInfo, path string) (dumpMeta, error) {
+	partPath := path + ".part"
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return dumpMeta{}, err
+	}
+	removePart := func() {
+		file.Close()
+		os.Remove(partPath)
+	}
+	unregister := onInterrupt(removePart)
+	defer unregister()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hash)}
+	if err := source.fetch(counter); err != nil {
+		removePart()
+		return dumpMeta{}, err
+	}
+	if info.size >= 0 && counter.n != info.size {
+		removePart()
+		return dumpMeta{}, fmt.Errorf("incomplete download: got %d of %d bytes", counter.n, info.size)
+	}
+	if err := file.Close(); err != nil {
+		removePart()
+		return dumpMeta{}, err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		removePart()
+		return dumpMeta{}, err
+	}
+	return dumpMeta{
+		Source:    source.String(),
+		Version:   info.version,
+		Size:      counter.n,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		FetchedAt: time.Now().UTC(),
+	}, nil
+}
+
+// s3Source is a dump in S3, reached through the Teleport AWS app or the aws CLI.
+type s3Source struct {
+	bucket, key, region, via string
+	session                  *teleportSession
+}
+
+func (s *s3Source) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.key)
+}
+
+// awsCommand returns the command running an aws CLI command, either directly or
+// through 'tsh aws' once the Teleport AWS app is logged into.
+func (s *s3Source) awsCommand(args ...string) (string, []string, error) {
+	if s.region != "" {
+		args = append(args, "--region", s.region)
+	}
+	if s.via == viaAWS {
+		path, err := lookPath("aws")
+		return path, args, err
+	}
+	if err := s.session.app(teleportConfig.AWSApp); err != nil {
+		return "", nil, err
+	}
+	path, err := lookPath("tsh")
+	return path, append([]string{"aws", "--app", teleportConfig.AWSApp}, args...), err
+}
+
+func (s *s3Source) fileName() string {
+	return path.Base(s.key)
+}
+
+func (s *s3Source) check() (sourceInfo, error) {
+	path, args, err := s.awsCommand("s3api", "head-object", "--bucket", s.bucket, "--key", s.key, "--output", "json")
+	if err != nil {
+		return sourceInfo{}, err
+	}
+	output, err := CaptureCommand(path, args...)
+	if err != nil {
+		return sourceInfo{}, err
+	}
+	head := struct {
+		ETag          string `json:"ETag"`
+		LastModified  string `json:"LastModified"`
+		ContentLength int64  `json:"ContentLength"`
+	}{ContentLength: -1}
+	if err := json.Unmarshal([]byte(output), &head); err != nil {
+		return sourceInfo{}, fmt.Errorf("error parsing head-object output: %w", err)
+	}
+	info := sourceInfo{version: head.ETag, size: head.ContentLength}
+	if info.version == "" {
+		info.version = head.LastModified
+	}
+	return info, nil
+}
+
+func (s *s3Source) fetch(w io.Writer) error {
+	path, args, err := s.awsCommand("s3", "cp", s.String(), "-")
+	if err != nil {
+		return err
+	}
+	return StreamCommand(CommandIO{Stdout: w}, path, args...)
+}
+
+// httpDumpTimeout bounds checking an HTTP dump source, and how long fetching a dump
+// may go without receiving data.
+var httpDumpTimeout = 30 * time.Second
+
+// httpDumpClient talks to HTTP dump sources. Its transport gives up on connections
+// that can't be set up; the requests carry their own deadlines.
+var httpDumpClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	DialContext:           (&net.Dialer{Timeout: httpDumpTimeout}).DialContext,
+	TLSHandshakeTimeout:   httpDumpTimeout,
+	ResponseHeaderTimeout: httpDumpTimeout,
+}}
+
+// httpSource is a dump served over HTTP(S).
+type httpSource struct {
+	url, name string
+}
+
+func (s httpSource) String() string {
+	return s.url
+}
+
+func (s httpSource) fileName() string {
+	if s.name == "" || s.name == "/" || s.name == "." {
+		return "dump.sql"
+	}
+	return s.name
+}
+
+func (s httpSource) check() (sourceInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), httpDumpTimeout)
+	defer cancel()
+	resp, err := s.request(ctx, http.MethodHead, false)
+	if err != nil {
+		return sourceInfo{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Presigned URLs are only valid for GET, and some servers don't answer HEAD
+		// at all, so ask for the first byte instead.
+		resp, err = s.request(ctx, http.MethodGet, true)
+		if err != nil {
+			return sourceInfo{}, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			// The version is unknown, so the dump is fetched, which reports
+			// what is wrong with the URL if anything is.
+			return sourceInfo{size: -1}, nil
+		}
+	}
+	// The size is left to the download: Go reports a body shorter than its
+	// Content-Length as an error, while HEAD responses don't always announce one.
+	info := sourceInfo{version: resp.Header.Get("ETag"), size: -1}
+	if info.version == "" {
+		info.version = resp.Header.Get("Last-Modified")
+	}
+	return info, nil
+}
+
+func (s httpSource) fetch(w io.Writer) error {
+	// The download is cancelled when no data arrives for httpDumpTimeout, rather
+	// than after a fixed time, which a large dump could need more than.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stall := time.AfterFunc(httpDumpTimeout, cancel)
+	defer stall.Stop()
+	stalled := func(err error) error {
+		if ctx.Err() != nil {
+			return fmt.Errorf("GET %s: no data received for %s", s.url, httpDumpTimeout)
+		}
+		return err
+	}
+
+	resp, err := s.request(ctx, http.MethodGet, false)
+	if err != nil {
+		return stalled(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", s.url, resp.Status)
+	}
+	// The progress line replaces the spinner while the dump is downloaded.
+	progress.Stop()
+	body := newTransferProgress(&stallReader{r: resp.Body, timer: stall}, resp.ContentLength, os.Stderr)
+	_, err = io.Copy(w, body)
+	body.finish()
+	if err != nil {
+		return stalled(err)
+	}
+	return nil
+}
+
+// request sends a request for the dump, for only its first byte when firstByte is set.
+func (s httpSource) request(ctx context.Context, method string, firstByte bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if firstByte {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	return httpDumpClient.Do(req)
+}
+
+// stallReader restarts a timer on every read, so that the timer only fires when
+// no data arrives for its duration.
+type stallReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.timer.Reset(httpDumpTimeout)
+	return n, err
+}
+
+// commandSource is a shell command whose standard output is the dump.
+type commandSource struct {
+	command, name string
+}
+
+func (s commandSource) String() string {
+	return fmt.Sprintf("command '%s'", s.command)
+}
+
+func (s commandSource) fileName() string {
+	return s.name
+}
+
+func (s commandSource) check() (sourceInfo, error) {
+	return sourceInfo{size: -1}, nil
+}
+
+func (s commandSource) fetch(w io.Writer) error {
+	return StreamCommand(CommandIO{Stdout: w}, "sh", "-c", s.command)
+}
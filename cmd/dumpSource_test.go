@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTools puts empty executables with the given names first in PATH, so that
+// lookPath finds them; the commands themselves are mocked.
+func fakeTools(t *testing.T, names ...string) {
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create fake %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestResolveDump_HTTP(t *testing.T) {
+	setup(t)
+	defer teardown()
+	etag := `"v1"`
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Method == http.MethodGet {
+			gets++
+			io.WriteString(w, "-- dump "+etag+"\n")
+		}
+	}))
+	defer server.Close()
+
+	target := DatabaseTarget{Name: "app", Source: DumpSourceConfig{URL: server.URL + "/backups/app.sql"}}
+	var path string
+	for i, want := range []struct {
+		etag    string
+		refresh bool
+		damage  bool
+		gets    int
+		content string
+	}{
+		{etag: `"v1"`, gets: 1, content: `-- dump "v1"`},
+		{etag: `"v1"`, gets: 1, content: `-- dump "v1"`},
+		{etag: `"v1"`, refresh: true, gets: 2, content: `-- dump "v1"`},
+		{etag: `"v1"`, damage: true, gets: 3, content: `-- dump "v1"`},
+		{etag: `"v2"`, gets: 4, content: `-- dump "v2"`},
+	} {
+		etag = want.etag
+		if want.damage {
+			if err := os.WriteFile(path, []byte("-- dump \"v1"), 0600); err != nil {
+				t.Fatalf("Failed to damage the cached dump: %v", err)
+			}
+		}
+		var err error
+		path, err = resolveDump(target, &teleportSession{}, want.refresh)
+		if err != nil {
+			t.Fatalf("resolveDump() #%d returned an error: %v", i, err)
+		}
+		if gets != want.gets {
+			t.Errorf("resolveDump() #%d: expected %d downloads in total, got %d", i, want.gets, gets)
+		}
+		if data, _ := os.ReadFile(path); strings.TrimSpace(string(data)) != want.content {
+			t.Errorf("resolveDump() #%d: expected %q, got %q", i, want.content, data)
+		}
+	}
+
+	if filepath.Base(path) != "app.sql" || !strings.Contains(path, filepath.Join("cache", "dumps", projectName(), "app")) {
+		t.Errorf("Expected the dump to be cached per project and database, got %s", path)
+	}
+	meta, err := readDumpMeta(path)
+	if err != nil || meta.Version != `"v2"` || meta.Source != server.URL+"/backups/app.sql" || meta.Size != int64(len(`-- dump "v2"`)+1) || len(meta.SHA256) != 64 {
+		t.Errorf("Unexpected dump metadata %+v (%v)", meta, err)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Expected no .part file to be left behind")
+	}
+
+	// An unreachable source falls back to the cached dump, but only while it verifies.
+	server.Close()
+	if got, err := resolveDump(target, &teleportSession{}, false); err != nil || got != path {
+		t.Errorf("Expected the cached dump to be used when the source is unreachable, got %q, %v", got, err)
+	}
+	os.WriteFile(path, []byte("truncated"), 0600)
+	if _, err := resolveDump(target, &teleportSession{}, false); ExitCode(err) != ExitToolFailed {
+		t.Errorf("Expected a damaged cached dump to be refused when the source is unreachable, got %v", err)
+	}
+}
+
+func TestResolveDump_HTTPWithoutHead(t *testing.T) {
+	setup(t)
+	defer teardown()
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Like a presigned URL, which is only signed for GET.
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") == "bytes=0-0" {
+			w.Header().Set("Content-Range", "bytes 0-0/8")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, "-")
+			return
+		}
+		gets++
+		io.WriteString(w, "-- dump\n")
+	}))
+	defer server.Close()
+
+	target := DatabaseTarget{Name: "app", Source: DumpSourceConfig{URL: server.URL + "/app.sql?X-Amz-Signature=abc"}}
+	for i := 0; i < 2; i++ {
+		path, err := resolveDump(target, &teleportSession{}, false)
+		if err != nil {
+			t.Fatalf("resolveDump() #%d returned an error: %v", i, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "-- dump\n" {
+			t.Errorf("resolveDump() #%d: unexpected dump %q", i, data)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("Expected the version from a ranged GET to keep the cached dump, got %d downloads", gets)
+	}
+}
+
+func TestHTTPSourceFetch_Stalled(t *testing.T) {
+	original := httpDumpTimeout
+	httpDumpTimeout = 100 * time.Millisecond
+	defer func() { httpDumpTimeout = original }()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "-- partial")
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	err := httpSource{url: server.URL + "/app.sql"}.fetch(io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Errorf("Expected a stalled download to fail, got %v", err)
+	}
+}
+
+func TestResolveDump_S3ViaTeleport(t *testing.T) {
+	setup(t)
+	defer teardown()
+	fakeTools(t, "tsh")
+	originalStream := StreamCommand
+	defer func() { StreamCommand = originalStream }()
+	mockExecuteTracker = []MockExecuteCommand{}
+	ExecuteCommand = mockExecuteCommandVolumes
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		return `{"ETag": "\"abc\"", "LastModified": "2026-01-01T00:00:00+00:00", "ContentLength": 11}`, nil
+	}
+	content := "-- from s3\n"
+	StreamCommand = func(input CommandIO, command string, args ...string) error {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		_, err := io.WriteString(input.Stdout, content)
+		return err
+	}
+	originalTeleport := teleportConfig
+	defer func() { teleportConfig = originalTeleport }()
+	teleportConfig = TeleportConfig{Host: "teleport.example.com", AWSApp: "aws", AWSRole: "dev"}
+	mockTeleport(t, "", time.Time{}, nil)
+
+	session := &teleportSession{}
+	targets := []DatabaseTarget{
+		{Name: "app", DBFile: "/tmp/ignored.sql", S3Bucket: "backups", S3Key: "nightly/app.sql", S3Region: "eu-west-1"},
+		{Name: "audit", Source: DumpSourceConfig{URL: "s3://backups/audit.sql"}},
+	}
+	for _, target := range targets {
+		path, err := resolveDump(target, session, false)
+		if err != nil {
+			t.Fatalf("resolveDump(%s) returned an error: %v", target.Name, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != content {
+			t.Errorf("Unexpected dump content %q", data)
+		}
+	}
+
+	var logins int
+	var commands []string
+	for _, call := range mockExecuteTracker {
+		args := strings.Join(call.Args, " ")
+		if strings.HasPrefix(args, "login") {
+			logins++
+		}
+		commands = append(commands, args)
+	}
+	if logins != 1 {
+		t.Errorf("Expected a single Teleport login for both dumps, got %d in %v", logins, commands)
+	}
+	want := "aws --app aws s3 cp s3://backups/nightly/app.sql - --region eu-west-1"
+	if !contains(commands, want) {
+		t.Errorf("Expected %q in %v", want, commands)
+	}
+
+	// A download shorter than the object in S3 is never cached.
+	path, _ := resolveDump(targets[1], session, false)
+	content = "-- from"
+	if _, err := resolveDump(targets[1], session, true); ExitCode(err) != ExitToolFailed || !strings.Contains(err.Error(), "incomplete download") {
+		t.Errorf("Expected an incomplete download to fail, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "-- from s3\n" {
+		t.Errorf("Expected the previous cached dump to be kept, got %q", data)
+	}
+}
+
+func TestResolveDump_Command(t *testing.T) {
+	setup(t)
+	defer teardown()
+	originalStream := StreamCommand
+	defer func() { StreamCommand = originalStream }()
+	runs := 0
+	fail := false
+	StreamCommand = func(input CommandIO, command string, args ...string) error {
+		runs++
+		if command != "sh" || args[0] != "-c" || args[1] != "ssh bastion cat latest.sql.gz" {
+			t.Errorf("Unexpected command %s %v", command, args)
+		}
+		io.WriteString(input.Stdout, "partial")
+		if fail {
+			return errors.New("exit status 255")
+		}
+		return nil
+	}
+
+	target := DatabaseTarget{Name: "app", DBFile: "/tmp/app.sql.gz", Source: DumpSourceConfig{Command: "ssh bastion cat latest.sql.gz"}}
+	var path string
+	for i := 0; i < 2; i++ {
+		var err error
+		if path, err = resolveDump(target, &teleportSession{}, false); err != nil {
+			t.Fatalf("resolveDump() returned an error: %v", err)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("Expected the command to run on every import, ran %d times", runs)
+	}
+	if filepath.Base(path) != "app.sql.gz" {
+		t.Errorf("Expected the dump to be cached under the db_file name, got %s", path)
+	}
+
+	fail = true
+	if _, err := resolveDump(target, &teleportSession{}, false); ExitCode(err) != ExitToolFailed {
+		t.Errorf("Expected a tool error when the command fails, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "partial" {
+		t.Errorf("Expected the previous dump to be kept, got %q", data)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Expected no .part file to be left behind")
+	}
+}
+
+func TestDumpSourceFor_Invalid(t *testing.T) {
+	for _, source := range []DumpSourceConfig{
+		{URL: "ftp://example.com/dump.sql"},
+		{URL: "s3://bucket-only"},
+		{URL: "s3://backups/dump.sql", Via: "gcloud"},
+		{URL: "https://example.com/dump.sql", Command: "cat dump.sql"},
+	} {
+		if _, err := dumpSourceFor(DatabaseTarget{Name: "app", Source: source}, nil); ExitCode(err) != ExitConfig {
+			t.Errorf("Expected a config error for %+v, got %v", source, err)
+		}
+	}
+}
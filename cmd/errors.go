@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Exit codes returned by upctl. They are part of the command line contract and
+// must not change; scripts wrapping upctl branch on them.
+const (
+	// ExitOK means the command succeeded.
+	ExitOK = 0
+	// ExitFailure is any failure that does not fit a more specific code.
+	ExitFailure = 1
+	// ExitUsage means the command line arguments or flags were invalid.
+	ExitUsage = 2
+	// ExitConfig means upctl.yaml could not be read, parsed or is missing required values.
+	ExitConfig = 3
+	// ExitRuntimeNotFound means a required executable (docker, tsh, helm, ...) is not installed.
+	ExitRuntimeNotFound = 4
+	// ExitServiceNotFound means a service, package or other named target is not in the configuration.
+	ExitServiceNotFound = 5
+	// ExitToolFailed means an external tool ran but reported a failure.
+	ExitToolFailed = 6
+)
+
+// ErrorKind classifies an Error and determines the exit code.
+type ErrorKind int
+
+// Kinds of errors returned by upctl commands.
+const (
+	KindFailure ErrorKind = iota
+	KindUsage
+	KindConfig
+	KindRuntimeNotFound
+	KindServiceNotFound
+	KindToolFailed
+)
+
+var kindExitCodes = map[ErrorKind]int{
+	KindFailure:         ExitFailure,
+	KindUsage:           ExitUsage,
+	KindConfig:          ExitConfig,
+	KindRuntimeNotFound: ExitRuntimeNotFound,
+	KindServiceNotFound: ExitServiceNotFound,
+	KindToolFailed:      ExitToolFailed,
+}
+
+// Error is an error returned by a command, carrying its kind so the root
+// command can map it to a stable exit code.
+type Error struct {
+	Kind ErrorKind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// usageError reports invalid arguments or flags.
+func usageError(format string, a ...interface{}) error {
+	return &Error{Kind: KindUsage, Msg: fmt.Sprintf(format, a...)}
+}
+
+// configError reports a problem with upctl.yaml.
+func configError(err error, format string, a ...interface{}) error {
+	return &Error{Kind: KindConfig, Msg: fmt.Sprintf(format, a...), Err: err}
+}
+
+// notFoundError reports services or other named targets that are not in the configuration.
+func notFoundError(what string, names []string, available []string) error {
+	msg := fmt.Sprintf("%s not found in configuration: %s", what, strings.Join(names, ", "))
+	if len(available) > 0 {
+		msg += fmt.Sprintf(" (available: %s)", strings.Join(available, ", "))
+	}
+	return &Error{Kind: KindServiceNotFound, Msg: msg}
+}
+
+// toolError reports a failed external command. A missing executable is
+// reported as runtime not found rather than as a tool failure.
+func toolError(err error, format string, a ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	kind := KindToolFailed
+	if errors.Is(err, exec.ErrNotFound) {
+		kind = KindRuntimeNotFound
+	}
+	var upctlErr *Error
+	if errors.As(err, &upctlErr) {
+		kind = upctlErr.Kind
+	}
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, a...), Err: err}
+}
+
+// lookPath finds an executable, reporting a missing one as runtime not found.
+func lookPath(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", &Error{Kind: KindRuntimeNotFound, Msg: fmt.Sprintf("'%s' not found in PATH", name), Err: err}
+	}
+	return path, nil
+}
+
+// ExitCode returns the exit code for an error returned by Execute.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var upctlErr *Error
+	if errors.As(err, &upctlErr) {
+		return kindExitCodes[upctlErr.Kind]
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return ExitRuntimeNotFound
+	}
+	// Errors from cobra itself are about unknown commands, flags or argument counts.
+	msg := err.Error()
+	if strings.HasPrefix(msg, "unknown command") || strings.HasPrefix(msg, "unknown flag") ||
+		strings.HasPrefix(msg, "unknown shorthand flag") || strings.Contains(msg, "arg(s)") ||
+		strings.HasPrefix(msg, "invalid argument") || strings.HasPrefix(msg, "flag needs an argument") {
+		return ExitUsage
+	}
+	return ExitFailure
+}
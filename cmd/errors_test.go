@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"nil", nil, ExitOK},
+		{"plain error", errors.New("boom"), ExitFailure},
+		{"usage", usageError("bad flag"), ExitUsage},
+		{"config", configError(errors.New("yaml: line 3"), "error reading config file"), ExitConfig},
+		{"not found", notFoundError("service(s)", []string{"web"}, nil), ExitServiceNotFound},
+		{"tool failed", toolError(errors.New("exit status 1"), "error starting services"), ExitToolFailed},
+		{"tool missing", toolError(&exec.Error{Name: "docker", Err: exec.ErrNotFound}, "error starting services"), ExitRuntimeNotFound},
+		{"wrapped", fmt.Errorf("while importing: %w", configError(nil, "no database")), ExitConfig},
+		{"tool error keeps inner kind", toolError(notFoundError("service(s)", []string{"db"}, nil), "error importing"), ExitServiceNotFound},
+		{"cobra arg count", cobra.MaximumNArgs(1)(&cobra.Command{}, []string{"a", "b"}), ExitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := ExitCode(tt.err); code != tt.expected {
+				t.Errorf("ExitCode(%v) = %d, expected %d", tt.err, code, tt.expected)
+			}
+		})
+	}
+}
+
+// captureCommand is the real CaptureCommand, which other tests replace.
+var captureCommand = CaptureCommand
+
+func TestExitCode_MissingCapturedTool(t *testing.T) {
+	_, err := captureCommand("upctl-no-such-tool")
+	if code := ExitCode(toolError(err, "error checking the session")); code != ExitRuntimeNotFound {
+		t.Errorf("Expected exit code %d for a missing tool, got %d (%v)", ExitRuntimeNotFound, code, err)
+	}
+}
+
+func TestError_Message(t *testing.T) {
+	err := toolError(errors.New("exit status 1"), "error installing service %s", "web")
+	if err.Error() != "error installing service web: exit status 1" {
+		t.Errorf("Unexpected error message: %s", err.Error())
+	}
+	if toolError(nil, "unused") != nil {
+		t.Errorf("toolError(nil) should return nil")
+	}
+}
+
+func TestRunDockerComposeInstall_UnknownService(t *testing.T) {
+	setup(t)
+	defer teardown()
+	useFakeRuntime(t, &fakeRuntime{})
+	testRootCmd, _ := InitializeTestCmd(t)
+
+	testInstallCmd := &cobra.Command{Use: "install", RunE: RunDockerComposeInstall}
+	testInstallCmd.Flags().BoolP("all", "a", false, "Install all services")
+	testRootCmd.AddCommand(testInstallCmd)
+
+	_, err := executeCommandCobra(testRootCmd, "install", "nope")
+	if ExitCode(err) != ExitServiceNotFound {
+		t.Errorf("Expected exit code %d for an unknown service, got %d (%v)", ExitServiceNotFound, ExitCode(err), err)
+	}
+}
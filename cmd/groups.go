@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// groupPrefix marks a command line argument as the name of a service group, e.g. "@observability".
+const groupPrefix = "@"
+
+// loadServiceGroups reads the 'groups' section of upctl.yaml, which maps a group
+// name to the services in it. Group names are case-insensitive because viper
+// lowercases map keys.
+func loadServiceGroups() (map[string][]string, error) {
+	groups := make(map[string][]string)
+	if err := viper.UnmarshalKey("groups", &groups); err != nil {
+		return nil, configError(err, "error loading groups")
+	}
+	return groups, nil
+}
+
+// validateServiceGroups checks that every group only lists configured services.
+func validateServiceGroups(groups map[string][]string, services map[string]ComposeService) error {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, service := range groups[name] {
+			if _, exists := services[service]; !exists {
+				return configError(nil, "group '%s' lists unknown service '%s'", name, service)
+			}
+		}
+	}
+	return nil
+}
+
+// expandGroups replaces every "@group" argument with the services of that group.
+// Other arguments are kept as they are. Unknown groups are reported together.
+func expandGroups(args []string) ([]string, error) {
+	var groups map[string][]string
+	var expanded, unknown []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, groupPrefix) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if groups == nil {
+			var err error
+			if groups, err = loadServiceGroups(); err != nil {
+				return nil, err
+			}
+		}
+		members, ok := groups[strings.ToLower(strings.TrimPrefix(arg, groupPrefix))]
+		if !ok {
+			unknown = append(unknown, arg)
+			continue
+		}
+		expanded = append(expanded, members...)
+	}
+	if len(unknown) > 0 {
+		available := make([]string, 0, len(groups))
+		for name := range groups {
+			available = append(available, groupPrefix+name)
+		}
+		sort.Strings(available)
+		return nil, notFoundError("group(s)", unknown, available)
+	}
+	return expanded, nil
+}
+
+// withDependencies returns services together with everything they depend on,
+// directly or through other services. Dependencies come before the services that
+// need them; a dependency that is not configured is left to Compose to report.
+func withDependencies(services []string, configured map[string]ComposeService) []string {
+	var ordered []string
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		service, ok := configured[name]
+		if !ok {
+			return
+		}
+		for _, dependency := range service.DependsOn.Names() {
+			visit(dependency)
+		}
+		ordered = append(ordered, name)
+	}
+	for _, name := range services {
+		visit(name)
+	}
+	return ordered
+}
+
+// withDependents returns services together with every configured service that
+// depends on them, directly or through other services. Services come after the
+// services that depend on them, which is the order to stop them in.
+func withDependents(services []string, configured map[string]ComposeService) []string {
+	dependents := make(map[string][]string)
+	for name, service := range configured {
+		for _, dependency := range service.DependsOn.Names() {
+			dependents[dependency] = append(dependents[dependency], name)
+		}
+	}
+
+	var ordered []string
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		names := dependents[name]
+		sort.Strings(names)
+		for _, dependent := range names {
+			visit(dependent)
+		}
+		ordered = append(ordered, name)
+	}
+	for _, name := range services {
+		visit(name)
+	}
+	return ordered
+}
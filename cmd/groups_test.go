@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const groupsTestConfig = `
+groups:
+  Observability: [grafana, prometheus]
+  data: [mysql]
+services:
+  loki:
+    image: grafana/loki
+  grafana:
+    image: grafana/grafana
+    depends_on: [loki]
+  prometheus:
+    image: prom/prometheus
+  mysql:
+    image: mysql:8.0
+`
+
+func setupGroupsTest(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(groupsTestConfig)); err != nil {
+		t.Fatalf("Failed to read test config: %v", err)
+	}
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	dockerComposeConfig = cfg
+	if progress == nil {
+		progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
+	}
+}
+
+func TestSelectServices_Groups(t *testing.T) {
+	setupGroupsTest(t)
+
+	services, err := selectServices([]string{"@observability", "mysql", "grafana"}, false)
+	if err != nil {
+		t.Fatalf("selectServices() returned an error: %v", err)
+	}
+	if expected := []string{"grafana", "prometheus", "mysql"}; !equalSlices(services, expected) {
+		t.Errorf("Expected %v, got %v", expected, services)
+	}
+
+	_, err = selectServices([]string{"@nope", "@data"}, false)
+	if ExitCode(err) != ExitServiceNotFound || !strings.Contains(err.Error(), "@nope") {
+		t.Errorf("Expected a not found error for @nope, got %v", err)
+	}
+}
+
+func TestWithDependencies(t *testing.T) {
+	setupGroupsTest(t)
+
+	services := withDependencies([]string{"grafana", "prometheus"}, dockerComposeConfig.Services)
+	if expected := []string{"loki", "grafana", "prometheus"}; !equalSlices(services, expected) {
+		t.Errorf("Expected %v, got %v", expected, services)
+	}
+}
+
+func TestValidateServiceGroups(t *testing.T) {
+	setupGroupsTest(t)
+
+	groups := map[string][]string{"broken": {"mysql", "redis"}}
+	err := validateServiceGroups(groups, dockerComposeConfig.Services)
+	if ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "'redis'") {
+		t.Errorf("Expected a config error for the unknown service, got %v", err)
+	}
+}
+
+func TestWithDependents(t *testing.T) {
+	setupGroupsTest(t)
+
+	services := withDependents([]string{"loki"}, dockerComposeConfig.Services)
+	if expected := []string{"grafana", "loki"}; !equalSlices(services, expected) {
+		t.Errorf("Expected %v, got %v", expected, services)
+	}
+}
+
+func newTestDownCmd() *cobra.Command {
+	downCmd := &cobra.Command{Use: "down", RunE: RunDockerComposeDown}
+	downCmd.Flags().BoolP("all", "a", false, "Stop all services")
+	downCmd.Flags().Bool("cascade", false, "Also stop dependent services")
+	downCmd.Flags().Bool("volumes", false, "Remove volumes")
+	return downCmd
+}
+
+func TestRunDockerComposeDown_Cascade(t *testing.T) {
+	setupGroupsTest(t)
+	t.Setenv("UPCTL_HOME", t.TempDir())
+
+	tests := []struct {
+		args     []string
+		call     string
+		services []string
+	}{
+		{[]string{"loki"}, "remove", []string{"loki"}},
+		{[]string{"loki", "--cascade"}, "remove", []string{"grafana", "loki"}},
+		{[]string{"--all"}, "down", nil},
+		{[]string{"--all", "--volumes"}, "down", []string{"--volumes"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			rt := &fakeRuntime{}
+			useFakeRuntime(t, rt)
+			downCmd := newTestDownCmd()
+			downCmd.SetArgs(tt.args)
+			if err := downCmd.Execute(); err != nil {
+				t.Fatalf("down %v failed: %v", tt.args, err)
+			}
+			if len(rt.calls) != 1 || rt.calls[0] != tt.call || !equalSlices(rt.services[0], tt.services) {
+				t.Errorf("Expected %s %v, got calls %v with services %v", tt.call, tt.services, rt.calls, rt.services)
+			}
+		})
+	}
+}
+
+func TestRunDockerComposeDown_VolumesRequireAll(t *testing.T) {
+	setupGroupsTest(t)
+	t.Setenv("UPCTL_HOME", t.TempDir())
+	useFakeRuntime(t, &fakeRuntime{})
+
+	downCmd := newTestDownCmd()
+	downCmd.SilenceUsage = true
+	downCmd.SetArgs([]string{"loki", "--volumes"})
+	if err := downCmd.Execute(); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error, got %v", err)
+	}
+}
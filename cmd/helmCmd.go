@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Backends that install, upgrade and remove packages.
+const (
+	backendCompose = "compose"
+	backendHelm    = "helm"
+)
+
+// HelmRepository is a Helm chart repository from the 'repositories' section of upctl.yaml.
+type HelmRepository struct {
+	Name     string `mapstructure:"name"`
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// HelmPackage is a Helm release from the 'packages' section of upctl.yaml.
+type HelmPackage struct {
+	Name        string   `mapstructure:"name"`
+	Chart       string   `mapstructure:"chart"`
+	Version     string   `mapstructure:"version"`
+	Namespace   string   `mapstructure:"namespace"`
+	ValuesFiles []string `mapstructure:"values_files"`
+	Set         []string `mapstructure:"set"`
+}
+
+// activeBackend returns the backend selected by --backend or the 'backend' key in upctl.yaml.
+func activeBackend() string {
+	if backend := viper.GetString("backend"); backend != "" {
+		return backend
+	}
+	return backendCompose
+}
+
+// loadHelmRepositories reads the 'repositories' section of upctl.yaml.
+func loadHelmRepositories() ([]HelmRepository, error) {
+	var repositories []HelmRepository
+	if err := viper.UnmarshalKey("repositories", &repositories); err != nil {
+		return nil, configError(err, "error loading repositories")
+	}
+	return repositories, nil
+}
+
+// loadHelmPackages reads the 'packages' section of upctl.yaml keyed by package name.
+func loadHelmPackages() (map[string]HelmPackage, []string, error) {
+	var packages []HelmPackage
+	if err := viper.UnmarshalKey("packages", &packages); err != nil {
+		return nil, nil, configError(err, "error loading packages")
+	}
+	byName := make(map[string]HelmPackage, len(packages))
+	names := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		if pkg.Name == "" {
+			return nil, nil, configError(nil, "every package needs a name")
+		}
+		if pkg.Chart == "" {
+			return nil, nil, configError(nil, "package '%s' has no chart", pkg.Name)
+		}
+		byName[pkg.Name] = pkg
+		names = append(names, pkg.Name)
+	}
+	return byName, names, nil
+}
+
+// packageNamespace returns the namespace a package is installed into.
+func packageNamespace(pkg HelmPackage) string {
+	if pkg.Namespace != "" {
+		return pkg.Namespace
+	}
+	return "default"
+}
+
+// packageValuesFiles returns the values files passed to Helm for a package: the
+// shared override file ~/.upctl/overrides/<package>.yaml when it exists, followed
+// by the package's own values_files so that those win.
+func packageValuesFiles(pkg HelmPackage) ([]string, error) {
+	var files []string
+	home, err := upctlHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range []string{".yaml", ".yml"} {
+		override := filepath.Join(home, "overrides", pkg.Name+ext)
+		if _, err := os.Stat(override); err == nil {
+			files = append(files, override)
+			break
+		}
+	}
+	for _, file := range pkg.ValuesFiles {
+		path, err := cleanPath(file)
+		if err != nil {
+			return nil, configError(err, "invalid values file '%s' for package '%s'", file, pkg.Name)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// helmReleaseArgs builds the arguments of 'helm upgrade' for a package.
+func helmReleaseArgs(pkg HelmPackage, install bool) ([]string, error) {
+	args := []string{"upgrade"}
+	if install {
+		args = append(args, "--install", "--create-namespace")
+	}
+	args = append(args, pkg.Name, pkg.Chart, "--namespace", packageNamespace(pkg))
+	if pkg.Version != "" {
+		args = append(args, "--version", pkg.Version)
+	}
+	files, err := packageValuesFiles(pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		args = append(args, "--values", file)
+	}
+	for _, set := range pkg.Set {
+		args = append(args, "--set", set)
+	}
+	return args, nil
+}
+
+// selectHelmPackages returns the packages named in args, or all packages when all is set.
+func selectHelmPackages(args []string, all bool) ([]HelmPackage, error) {
+	packages, names, err := loadHelmPackages()
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		selected := make([]HelmPackage, 0, len(names))
+		for _, name := range names {
+			selected = append(selected, packages[name])
+		}
+		return selected, nil
+	}
+
+	var selected []HelmPackage
+	var unknown []string
+	for _, name := range args {
+		pkg, ok := packages[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected = append(selected, pkg)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(names)
+		return nil, notFoundError("package(s)", unknown, names)
+	}
+	return selected, nil
+}
+
+// RunHelmRepoConfig adds or updates every repository from upctl.yaml and refreshes the Helm repository cache.
+func RunHelmRepoConfig() error {
+	repositories, err := loadHelmRepositories()
+	if err != nil {
+		return err
+	}
+	if len(repositories) == 0 {
+		fmt.Println("No repositories defined in configuration")
+		return nil
+	}
+
+	for _, repo := range repositories {
+		fmt.Printf("Adding repository %s (%s)...\n", repo.Name, repo.URL)
+		args := []string{"repo", "add", repo.Name, repo.URL, "--force-update"}
+		var err error
+		if repo.Username != "" {
+			// The password is passed on stdin so that it never appears in the process list.
+			args = append(args, "--username", repo.Username, "--password-stdin")
+			err = StreamCommand(CommandIO{Stdin: strings.NewReader(repo.Password)}, "helm", args...)
+		} else {
+			err = ExecuteCommand("helm", args...)
+		}
+		if err != nil {
+			return toolError(err, "error adding repository %s", repo.Name)
+		}
+	}
+
+	fmt.Println("Updating repositories...")
+	if err := ExecuteCommand("helm", "repo", "update"); err != nil {
+		return toolError(err, "error updating repositories")
+	}
+	fmt.Println("Repositories configured successfully")
+	return nil
+}
+
+// RunHelmInstall installs the requested packages, upgrading releases that already exist.
+func RunHelmInstall(cmd *cobra.Command, args []string) error {
+	return runHelmRelease(cmd, args, true)
+}
+
+// RunHelmUpgrade upgrades already installed releases of the requested packages.
+func RunHelmUpgrade(cmd *cobra.Command, args []string) error {
+	return runHelmRelease(cmd, args, false)
+}
+
+func runHelmRelease(cmd *cobra.Command, args []string, install bool) error {
+	progress.Start()
+	defer progress.Stop()
+
+	all, _ := cmd.Flags().GetBool("all")
+	if !(len(args) > 0 || all) {
+		return usageError("please provide a package name or --all flag")
+	}
+
+	packages, err := selectHelmPackages(args, all)
+	if err != nil {
+		return err
+	}
+
+	action := "Upgrading"
+	if install {
+		action = "Installing"
+	}
+	for _, pkg := range packages {
+		fmt.Printf("%s package: %s\n", action, pkg.Name)
+		helmArgs, err := helmReleaseArgs(pkg, install)
+		if err != nil {
+			return err
+		}
+		if wait, timeout := waitFlags(cmd); wait {
+			helmArgs = append(helmArgs, "--wait", "--timeout", timeout.String())
+		}
+		if err := ExecuteCommand("helm", helmArgs...); err != nil {
+			return toolError(err, "error %s package %s", strings.ToLower(action), pkg.Name)
+		}
+	}
+	fmt.Printf("%d package(s) done\n", len(packages))
+	return nil
+}
+
+// RunHelmRemove uninstalls the releases of the requested packages.
+func RunHelmRemove(cmd *cobra.Command, args []string) error {
+	progress.Start()
+	defer progress.Stop()
+
+	all, _ := cmd.Flags().GetBool("all")
+	packages, err := selectHelmPackages(args, all)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range packages {
+		fmt.Printf("Removing package: %s\n", pkg.Name)
+		if err := ExecuteCommand("helm", "uninstall", pkg.Name, "--namespace", packageNamespace(pkg)); err != nil {
+			return toolError(err, "error removing package %s", pkg.Name)
+		}
+	}
+	fmt.Printf("%d package(s) removed\n", len(packages))
+	return nil
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove [package...]",
+	Short: "Remove Helm packages",
+	Long:  `Uninstalls the Helm releases of the given packages from the 'packages' section of upctl.yaml. Only available with the helm backend.`,
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(ccmd *cobra.Command, args []string) error {
+		all, _ := ccmd.Flags().GetBool("all")
+		if all && len(args) > 0 {
+			return usageError("cannot specify package names when the --all flag is used for 'remove'")
+		}
+		if !all && len(args) == 0 {
+			return usageError("you must specify a package name or use the --all flag for 'remove'")
+		}
+		if activeBackend() != backendHelm {
+			return usageError("'remove' is only supported by the helm backend; use 'upctl down' for Docker Compose services")
+		}
+		return RunHelmRemove(ccmd, args)
+	},
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [package...]",
+	Short: "Upgrade installed Helm packages",
+	Long:  `Upgrades the Helm releases of the given packages with the chart version and values from upctl.yaml. Only available with the helm backend.`,
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(ccmd *cobra.Command, args []string) error {
+		all, _ := ccmd.Flags().GetBool("all")
+		if all && len(args) > 0 {
+			return usageError("cannot specify package names when the --all flag is used for 'upgrade'")
+		}
+		if activeBackend() != backendHelm {
+			return usageError("'upgrade' is only supported by the helm backend; use 'upctl up' for Docker Compose services")
+		}
+		return RunHelmUpgrade(ccmd, args)
+	},
+}
+
+func init() {
+	removeCmd.Flags().BoolP("all", "a", false, "Remove all packages")
+	upgradeCmd.Flags().BoolP("all", "a", false, "Upgrade all packages")
+}
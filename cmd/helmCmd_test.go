@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/spf13/viper"
+)
+
+const helmTestConfig = `
+backend: helm
+repositories:
+  - name: grafana
+    url: https://grafana.github.io/helm-charts
+  - name: private
+    url: https://charts.example.com
+    username: bob
+    password: secret
+packages:
+  - name: grafana
+    chart: grafana/grafana
+    version: 7.0.0
+    namespace: monitoring
+    set:
+      - adminUser=admin
+  - name: loki
+    chart: grafana/loki
+`
+
+func setupHelmTest(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("UPCTL_HOME", t.TempDir())
+
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(helmTestConfig)); err != nil {
+		t.Fatalf("Failed to read helm test config: %v", err)
+	}
+
+	originalExecuteCommand := ExecuteCommand
+	ExecuteCommand = mockExecuteCommandVolumes
+	mockExecuteTracker = []MockExecuteCommand{}
+	originalStreamCommand := StreamCommand
+	StreamCommand = mockStreamCommand
+	t.Cleanup(func() {
+		ExecuteCommand = originalExecuteCommand
+		StreamCommand = originalStreamCommand
+	})
+
+	if progress == nil {
+		progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(io.Discard))
+	}
+}
+
+func TestHelmReleaseArgs(t *testing.T) {
+	setupHelmTest(t)
+
+	overridesDir := filepath.Join(os.Getenv("UPCTL_HOME"), "overrides")
+	if err := os.MkdirAll(overridesDir, 0755); err != nil {
+		t.Fatalf("Failed to create overrides dir: %v", err)
+	}
+	overrideFile := filepath.Join(overridesDir, "grafana.yaml")
+	if err := os.WriteFile(overrideFile, []byte("replicas: 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write override file: %v", err)
+	}
+
+	packages, _, err := loadHelmPackages()
+	if err != nil {
+		t.Fatalf("loadHelmPackages() returned an error: %v", err)
+	}
+
+	args, err := helmReleaseArgs(packages["grafana"], true)
+	if err != nil {
+		t.Fatalf("helmReleaseArgs() returned an error: %v", err)
+	}
+	expected := []string{"upgrade", "--install", "--create-namespace", "grafana", "grafana/grafana",
+		"--namespace", "monitoring", "--version", "7.0.0", "--values", overrideFile, "--set", "adminUser=admin"}
+	if !equalSlices(args, expected) {
+		t.Errorf("Expected helm args %v, got %v", expected, args)
+	}
+
+	args, err = helmReleaseArgs(packages["loki"], false)
+	if err != nil {
+		t.Fatalf("helmReleaseArgs() returned an error: %v", err)
+	}
+	expected = []string{"upgrade", "loki", "grafana/loki", "--namespace", "default"}
+	if !equalSlices(args, expected) {
+		t.Errorf("Expected helm args %v, got %v", expected, args)
+	}
+}
+
+func TestSelectHelmPackages_Unknown(t *testing.T) {
+	setupHelmTest(t)
+
+	_, err := selectHelmPackages([]string{"grafana", "nope", "missing"}, false)
+	if err == nil {
+		t.Fatalf("Expected an error for unknown packages")
+	}
+	if !strings.Contains(err.Error(), "nope, missing") {
+		t.Errorf("Expected error to list unknown packages, got: %v", err)
+	}
+}
+
+func TestRunHelmRepoConfig(t *testing.T) {
+	setupHelmTest(t)
+
+	RunHelmRepoConfig()
+
+	if len(mockExecuteTracker) != 3 {
+		t.Fatalf("Expected 3 helm calls, got %d: %v", len(mockExecuteTracker), mockExecuteTracker)
+	}
+	first := mockExecuteTracker[0]
+	if first.Command != "helm" || !equalSlices(first.Args, []string{"repo", "add", "grafana", "https://grafana.github.io/helm-charts", "--force-update"}) {
+		t.Errorf("Unexpected first call: %s %v", first.Command, first.Args)
+	}
+	second := mockExecuteTracker[1]
+	if !equalSlices(second.Args, []string{"repo", "add", "private", "https://charts.example.com", "--force-update", "--username", "bob", "--password-stdin"}) {
+		t.Errorf("Unexpected second call: %v", second.Args)
+	}
+	if second.Stdin != "secret" {
+		t.Errorf("Expected the repository password on stdin, got %q", second.Stdin)
+	}
+	if !equalSlices(mockExecuteTracker[2].Args, []string{"repo", "update"}) {
+		t.Errorf("Expected 'helm repo update' last, got %v", mockExecuteTracker[2].Args)
+	}
+}
+
+func TestRemoveCmd(t *testing.T) {
+	setupHelmTest(t)
+
+	if err := removeCmd.RunE(removeCmd, []string{"grafana"}); err != nil {
+		t.Fatalf("remove grafana failed: %v", err)
+	}
+	if len(mockExecuteTracker) != 1 {
+		t.Fatalf("Expected 1 helm call, got %d", len(mockExecuteTracker))
+	}
+	expected := []string{"uninstall", "grafana", "--namespace", "monitoring"}
+	if mockExecuteTracker[0].Command != "helm" || !equalSlices(mockExecuteTracker[0].Args, expected) {
+		t.Errorf("Expected helm %v, got %s %v", expected, mockExecuteTracker[0].Command, mockExecuteTracker[0].Args)
+	}
+
+	viper.Set("backend", backendCompose)
+	if err := removeCmd.RunE(removeCmd, []string{"grafana"}); err == nil {
+		t.Errorf("Expected 'remove' to fail with the compose backend")
+	}
+}
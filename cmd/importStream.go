@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the import progress line is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// transferProgress counts the bytes read through it and draws a progress line
+// with the percentage of total and the throughput.
+type transferProgress struct {
+	r       io.Reader
+	out     io.Writer
+	total   int64
+	read    int64
+	started time.Time
+	drawn   time.Time
+}
+
+func newTransferProgress(r io.Reader, total int64, out io.Writer) *transferProgress {
+	return &transferProgress{r: r, out: out, total: total, started: time.Now()}
+}
+
+func (p *transferProgress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if now := time.Now(); now.Sub(p.drawn) >= progressInterval {
+		p.drawn = now
+		p.draw()
+	}
+	return n, err
+}
+
+func (p *transferProgress) draw() {
+	elapsed := time.Since(p.started).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.read) / elapsed
+	}
+	line := formatBytes(p.read)
+	if p.total > 0 {
+		line = fmt.Sprintf("%s / %s (%d%%)", line, formatBytes(p.total), p.read*100/p.total)
+	}
+	fmt.Fprintf(p.out, "\r  %s  %s/s   ", line, formatBytes(int64(rate)))
+}
+
+// finish draws the final state of the progress line and ends it.
+func (p *transferProgress) finish() {
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// dumpStream is an opened database dump, decompressed on the fly.
+type dumpStream struct {
+	io.Reader
+	progress *transferProgress
+	closers  []func() error
+}
+
+// Close releases the file and stops a decompression process, returning the first error.
+func (d *dumpStream) Close() error {
+	var first error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if err := d.closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openDump opens a database dump for streaming. Dumps ending in .gz and .bz2 are
+// decompressed in process; .zst dumps are decompressed with the zstd tool. The
+// progress is measured on the file as read from disk, so the percentage is right
+// for compressed dumps too.
+func openDump(path string, progressOut io.Writer) (*dumpStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	dump := &dumpStream{closers: []func() error{file.Close}}
+	dump.progress = newTransferProgress(file, info.Size(), progressOut)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		gz, err := gzip.NewReader(dump.progress)
+		if err != nil {
+			dump.Close()
+			return nil, fmt.Errorf("error reading gzip dump '%s': %w", path, err)
+		}
+		dump.Reader = gz
+		dump.closers = append(dump.closers, gz.Close)
+	case ".bz2":
+		dump.Reader = bzip2.NewReader(dump.progress)
+	case ".zst":
+		zstdPath, err := lookPath("zstd")
+		if err != nil {
+			dump.Close()
+			return nil, err
+		}
+		zstd := exec.Command(zstdPath, "-dc")
+		zstd.Stdin = dump.progress
+		zstd.Stderr = os.Stderr
+		stdout, err := zstd.StdoutPipe()
+		if err != nil {
+			dump.Close()
+			return nil, err
+		}
+		if err := zstd.Start(); err != nil {
+			dump.Close()
+			return nil, err
+		}
+		var once sync.Once
+		var waitErr error
+		dump.Reader = stdout
+		dump.closers = append(dump.closers, func() error {
+			once.Do(func() {
+				// Stop zstd if the import ended before the dump was read to the end.
+				stdout.Close()
+				waitErr = zstd.Wait()
+			})
+			return waitErr
+		})
+	default:
+		dump.Reader = dump.progress
+	}
+	return dump, nil
+}
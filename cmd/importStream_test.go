@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024:        "5.0 MiB",
+		3 * 1024 * 1024 * 1024: "3.0 GiB",
+	}
+	for n, expected := range tests {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
+
+func writeGzipDump(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "dump.sql.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write dump: %v", err)
+	}
+	return path
+}
+
+func TestOpenDump_Gzip(t *testing.T) {
+	content := strings.Repeat("INSERT INTO t VALUES (1);\n", 1000)
+	path := writeGzipDump(t, content)
+
+	var progressOut bytes.Buffer
+	dump, err := openDump(path, &progressOut)
+	if err != nil {
+		t.Fatalf("openDump() returned an error: %v", err)
+	}
+	data, err := io.ReadAll(dump)
+	if err != nil {
+		t.Fatalf("Reading the dump failed: %v", err)
+	}
+	dump.progress.finish()
+	if err := dump.Close(); err != nil {
+		t.Fatalf("Close() returned an error: %v", err)
+	}
+
+	if string(data) != content {
+		t.Errorf("Expected the decompressed dump, got %d bytes", len(data))
+	}
+	if !strings.Contains(progressOut.String(), "(100%)") {
+		t.Errorf("Expected the progress line to reach 100%%, got %q", progressOut.String())
+	}
+}
+
+func TestRunDockerImportDB_StreamsDump(t *testing.T) {
+	setup(t)
+	defer teardown()
+	rt := &fakeRuntime{}
+	useFakeRuntime(t, rt)
+
+	content := "CREATE TABLE t (id INT);\n"
+	originalConfig := mysqlConfig
+	defer func() { mysqlConfig = originalConfig }()
+	mysqlConfig = MySQLConfig{User: "user", Password: "pwd", Database: "db", DBFile: writeGzipDump(t, content)}
+	viper.Set("services", map[string]interface{}{"mysql": map[string]interface{}{"image": "mysql:8.0"}})
+
+	if err := RunDockerImportDB(&cobra.Command{}, nil); err != nil {
+		t.Fatalf("RunDockerImportDB() returned an error: %v", err)
+	}
+	if string(rt.stdin) != content {
+		t.Errorf("Expected the decompressed dump on stdin, got %q", rt.stdin)
+	}
+	for _, call := range rt.calls {
+		if call == "copy" {
+			t.Errorf("The dump should be streamed, not copied into the container; calls: %v", rt.calls)
+		}
+	}
+}
+
+func TestRunInterruptCleanups(t *testing.T) {
+	var order []string
+	onInterrupt(func() { order = append(order, "first") })
+	unregister := onInterrupt(func() { order = append(order, "removed") })
+	onInterrupt(func() { order = append(order, "last") })
+	unregister()
+
+	RunInterruptCleanups()
+	RunInterruptCleanups() // cleanups run only once
+	if expected := []string{"last", "first"}; !equalSlices(order, expected) {
+		t.Errorf("Expected cleanups %v, got %v", expected, order)
+	}
+}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/subosito/gotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of environment variables that override configuration keys.
+const envPrefix = "UPCTL_"
+
+// reservedEnv are UPCTL_ variables that configure upctl itself rather than a key.
+var reservedEnv = map[string]bool{"UPCTL_HOME": true}
+
+// configEnv returns the variables available to the configuration: those in the .env
+// file next to the project file, overridden by the environment.
+func configEnv(projectFile string) (map[string]string, error) {
+	env := make(map[string]string)
+	if projectFile != "" {
+		path := filepath.Join(filepath.Dir(projectFile), ".env")
+		dotenv, err := gotenv.Read(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading '%s': %w", path, err)
+		}
+		for name, value := range dotenv {
+			env[name] = value
+		}
+	}
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	return env, nil
+}
+
+// interpolator expands ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?error} and
+// ${VAR?error} in configuration values, like Docker Compose. $$ is a literal $.
+type interpolator struct {
+	env map[string]string
+	// keepEscapes leaves $$ alone, for values that Docker Compose unescapes itself.
+	keepEscapes bool
+	// unresolved collects the variables that could not be expanded.
+	unresolved []string
+}
+
+// config interpolates every string in a configuration value; key is its path.
+func (x *interpolator) config(value interface{}, key string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return x.expand(v, key)
+	case map[string]interface{}:
+		for k, item := range v {
+			child := k
+			if key != "" {
+				child = key + "." + k
+			}
+			v[k] = x.config(item, child)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = x.config(item, fmt.Sprintf("%s[%d]", key, i))
+		}
+	}
+	return value
+}
+
+// expand interpolates a single value.
+func (x *interpolator) expand(s, key string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] != '$':
+			b.WriteByte(s[i])
+			i++
+		case strings.HasPrefix(s[i:], "$$"):
+			if x.keepEscapes {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte('$')
+			}
+			i += 2
+		case strings.HasPrefix(s[i:], "${"):
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				x.unresolved = append(x.unresolved, fmt.Sprintf("%s in %s: missing '}'", s[i:], key))
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			b.WriteString(x.substitute(s[i+2:end], key))
+			i = end + 1
+		default:
+			b.WriteByte('$')
+			i++
+		}
+	}
+	return b.String()
+}
+
+// closingBrace returns the index of the '}' closing a '${' whose expression starts
+// at start, allowing nested ${...} in defaults, or -1 when there is none.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// literal returns the value of a variable as it is written into the result. Where
+// Docker Compose interpolates the result again, its '$' are escaped so that a value
+// such as 'a$bc' isn't taken for a variable a second time.
+func (x *interpolator) literal(value string) string {
+	if x.keepEscapes {
+		return strings.ReplaceAll(value, "$", "$$")
+	}
+	return value
+}
+
+// substitute returns the value of the expression inside ${...}.
+func (x *interpolator) substitute(expr, key string) string {
+	n := 0
+	for n < len(expr) && (expr[n] == '_' || expr[n] >= 'A' && expr[n] <= 'Z' || expr[n] >= 'a' && expr[n] <= 'z' || n > 0 && expr[n] >= '0' && expr[n] <= '9') {
+		n++
+	}
+	name, op := expr[:n], expr[n:]
+	if name == "" {
+		x.unresolved = append(x.unresolved, fmt.Sprintf("${%s} in %s: invalid variable name", expr, key))
+		return ""
+	}
+	value, set := x.env[name]
+	switch {
+	case op == "":
+		if !set {
+			x.unresolved = append(x.unresolved, fmt.Sprintf("${%s} in %s: variable is not set", name, key))
+		}
+		return x.literal(value)
+	case strings.HasPrefix(op, ":-"):
+		if !set || value == "" {
+			return x.expand(op[2:], key)
+		}
+		return x.literal(value)
+	case strings.HasPrefix(op, "-"):
+		if !set {
+			return x.expand(op[1:], key)
+		}
+		return x.literal(value)
+	case strings.HasPrefix(op, ":?"), strings.HasPrefix(op, "?"):
+		empty := strings.HasPrefix(op, ":") && value == ""
+		if set && !empty {
+			return x.literal(value)
+		}
+		message := x.expand(op[strings.Index(op, "?")+1:], key)
+		if message == "" {
+			message = "variable is not set"
+		}
+		x.unresolved = append(x.unresolved, fmt.Sprintf("${%s} in %s: %s", name, key, message))
+		return ""
+	}
+	x.unresolved = append(x.unresolved, fmt.Sprintf("${%s} in %s: unsupported expression", expr, key))
+	return ""
+}
+
+// interpolateConfig expands the variables in every value of the merged
+// configuration. Services, volumes and networks are rendered into a compose file,
+// where Docker Compose unescapes $$ itself, so it is left alone there and a '$' in a
+// variable's value is written as $$.
+func interpolateConfig(config map[string]interface{}, env map[string]string) error {
+	var unresolved []string
+	for key, value := range config {
+		x := &interpolator{env: env, keepEscapes: composeSections[key]}
+		config[key] = x.config(value, key)
+		unresolved = append(unresolved, x.unresolved...)
+	}
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		return fmt.Errorf("unresolved variables in the configuration:\n  %s", strings.Join(unresolved, "\n  "))
+	}
+	return nil
+}
+
+// applyEnvOverrides sets configuration keys from UPCTL_ variables. UPCTL_MYSQL_PASSWORD
+// sets mysql.password: the name is matched against the keys that exist, and what is
+// left of it names a key in the deepest matching section. '__' separates keys
+// explicitly, as in UPCTL_SERVICES__API__IMAGE. A value replacing a number, boolean,
+// list or mapping is parsed as YAML. Values are taken literally: in the sections
+// rendered into the compose file their '$' are escaped for Docker Compose.
+func applyEnvOverrides(config map[string]interface{}, env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		// The UPCTL_SECRET_ variables carry resolved secrets to Docker Compose.
+		if strings.HasPrefix(name, envPrefix) && !reservedEnv[name] && !strings.HasPrefix(name, secretEnvPrefix) && len(name) > len(envPrefix) {
+			names = append(names, name)
+		}
+	}
+	// Sorted, so that UPCTL_MYSQL is applied before UPCTL_MYSQL_PASSWORD.
+	sort.Strings(names)
+	for _, name := range names {
+		section, key, top := envOverrideKey(config, strings.ToLower(strings.TrimPrefix(name, envPrefix)))
+		value := interface{}(env[name])
+		if existing, ok := section[key]; ok && existing != nil {
+			if _, isString := existing.(string); !isString {
+				var parsed interface{}
+				if err := yaml.Unmarshal([]byte(env[name]), &parsed); err != nil {
+					return fmt.Errorf("error parsing %s: %w", name, err)
+				}
+				value = parsed
+			}
+		}
+		if composeSections[top] {
+			value = escapeDollars(value)
+		}
+		section[key] = value
+	}
+	return nil
+}
+
+// escapeDollars writes every '$' in the strings of a value as $$, so that Docker
+// Compose reads them literally.
+func escapeDollars(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ReplaceAll(v, "$", "$$")
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = escapeDollars(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = escapeDollars(item)
+		}
+	}
+	return value
+}
+
+// envOverrideKey returns the section and key an override variable (without its
+// prefix, in lower case) sets, creating the sections of explicit '__' paths, and the
+// top-level key the path starts with.
+func envOverrideKey(config map[string]interface{}, name string) (map[string]interface{}, string, string) {
+	if strings.Contains(name, "__") {
+		parts := strings.Split(name, "__")
+		top := existingKey(config, parts[0])
+		section := config
+		for _, part := range parts[:len(parts)-1] {
+			part = existingKey(section, part)
+			next, ok := section[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				section[part] = next
+			}
+			section = next
+		}
+		return section, existingKey(section, parts[len(parts)-1]), top
+	}
+
+	section, top := config, ""
+	for {
+		keys := make([]string, 0, len(section))
+		for k := range section {
+			keys = append(keys, k)
+		}
+		// The longest key wins, so docker_config is preferred over docker.
+		sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+		descended := false
+		for _, k := range keys {
+			lower := strings.ToLower(k)
+			if lower == name {
+				if top == "" {
+					top = k
+				}
+				return section, k, top
+			}
+			next, isMap := section[k].(map[string]interface{})
+			if isMap && strings.HasPrefix(name, lower+"_") {
+				if top == "" {
+					top = k
+				}
+				section, name = next, strings.TrimPrefix(name, lower+"_")
+				descended = true
+				break
+			}
+		}
+		if !descended {
+			if top == "" {
+				top = name
+			}
+			return section, name, top
+		}
+	}
+}
+
+// existingKey returns the key of section that equals name ignoring case, or name.
+func existingKey(section map[string]interface{}, name string) string {
+	for k := range section {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
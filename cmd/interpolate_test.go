@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestInterpolatorExpand(t *testing.T) {
+	env := map[string]string{"USER": "alice", "EMPTY": "", "PORT": "3306", "PW": "a$bc"}
+	tests := []struct {
+		name        string
+		value       string
+		keepEscapes bool
+		want        string
+		wantErr     string
+	}{
+		{name: "plain value", value: "localhost", want: "localhost"},
+		{name: "variable", value: "${USER}@${PORT}", want: "alice@3306"},
+		{name: "default when unset", value: "${MISSING:-root}", want: "root"},
+		{name: "default when empty", value: "${EMPTY:-root}", want: "root"},
+		{name: "dash default keeps empty", value: "${EMPTY-root}", want: ""},
+		{name: "nested default", value: "${MISSING:-${USER}}", want: "alice"},
+		{name: "set variable ignores default", value: "${USER:-root}", want: "alice"},
+		{name: "escaped dollar", value: "pa$$word $${USER}", want: "pa$word ${USER}"},
+		{name: "escaped dollar kept for compose", value: "pa$$word", keepEscapes: true, want: "pa$$word"},
+		{name: "bare dollar is literal", value: "pa$word", want: "pa$word"},
+		{name: "dollar in a value", value: "${PW}", want: "a$bc"},
+		{name: "dollar in a value escaped for compose", value: "${PW}:${MISSING:-$$}", keepEscapes: true, want: "a$$bc:$$"},
+		{name: "unset variable", value: "${MISSING}", wantErr: "${MISSING} in key: variable is not set"},
+		{name: "required with message", value: "${EMPTY:?set the password}", wantErr: "${EMPTY} in key: set the password"},
+		{name: "required without message", value: "${MISSING?}", wantErr: "${MISSING} in key: variable is not set"},
+		{name: "question mark allows empty", value: "${EMPTY?required}", want: ""},
+		{name: "missing brace", value: "${USER", wantErr: "missing '}'"},
+		{name: "invalid name", value: "${1A}", wantErr: "invalid variable name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := &interpolator{env: env, keepEscapes: tt.keepEscapes}
+			got := x.expand(tt.value, "key")
+			if tt.wantErr != "" {
+				if len(x.unresolved) != 1 || !strings.Contains(x.unresolved[0], tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, x.unresolved)
+				}
+				return
+			}
+			if len(x.unresolved) > 0 || got != tt.want {
+				t.Errorf("expand(%q) = %q, %v; want %q", tt.value, got, x.unresolved, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateConfig_ListsUnresolved(t *testing.T) {
+	config := map[string]interface{}{
+		"mysql": map[string]interface{}{"password": "${MYSQL_PASSWORD}"},
+		"services": map[string]interface{}{
+			"grafana": map[string]interface{}{
+				"environment": []interface{}{"GF_SECURITY_ADMIN_PASSWORD=${GF_PASSWORD:?set GF_PASSWORD}"},
+			},
+		},
+	}
+	err := interpolateConfig(config, map[string]string{})
+	if err == nil {
+		t.Fatal("Expected an error for unresolved variables")
+	}
+	for _, want := range []string{
+		"${MYSQL_PASSWORD} in mysql.password: variable is not set",
+		"${GF_PASSWORD} in services.grafana.environment[0]: set GF_PASSWORD",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in the error, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	config := map[string]interface{}{
+		"mysql":         map[string]interface{}{"host": "localhost", "port": 3306},
+		"docker_config": map[string]interface{}{"use_teleport": true},
+		"services": map[string]interface{}{
+			"api": map[string]interface{}{"image": "api:1.0"},
+			"db":  map[string]interface{}{"environment": map[string]interface{}{"PASSWORD": "x"}},
+		},
+		"volumes": map[string]interface{}{"share": map[string]interface{}{"driver_opts": map[string]interface{}{"o": "x"}}},
+	}
+	env := map[string]string{
+		"UPCTL_HOME":                             "/ignored",
+		"UPCTL_MYSQL_PASSWORD":                   "s3$cret",
+		"UPCTL_MYSQL_PORT":                       "3307",
+		"UPCTL_DOCKER_CONFIG_USE_TELEPORT":       "false",
+		"UPCTL_SERVICES__API__IMAGE":             "api:2.0",
+		"UPCTL_SERVICES_DB_ENVIRONMENT_PASSWORD": "a$b",
+		"UPCTL_VOLUMES__SHARE__DRIVER_OPTS__O":   "pa$s",
+		"UPCTL_PROJECT":                          "demo",
+		"PATH":                                   "/usr/bin",
+	}
+	if err := applyEnvOverrides(config, env); err != nil {
+		t.Fatalf("applyEnvOverrides() returned an error: %v", err)
+	}
+	want := map[string]interface{}{
+		"mysql":         map[string]interface{}{"host": "localhost", "port": 3307, "password": "s3$cret"},
+		"docker_config": map[string]interface{}{"use_teleport": false},
+		// Docker Compose reads $$ back as $.
+		"services": map[string]interface{}{
+			"api": map[string]interface{}{"image": "api:2.0"},
+			"db":  map[string]interface{}{"environment": map[string]interface{}{"PASSWORD": "a$$b"}},
+		},
+		"volumes": map[string]interface{}{"share": map[string]interface{}{"driver_opts": map[string]interface{}{"o": "pa$$s"}}},
+		"project": "demo",
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("Expected %v, got %v", want, config)
+	}
+}
+
+func TestReadConfig_DotEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+	chdir(t, project)
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("DB_USER", "from-environment")
+
+	writeConfigFile(t, filepath.Join(project, ".env"), "DB_PASSWORD=\"from dotenv\"\nDB_USER=from-dotenv\nUPCTL_PROJECT=demo\n")
+	writeConfigFile(t, "upctl.yaml", `
+mysql:
+  user: ${DB_USER}
+  password: ${DB_PASSWORD}
+  database: ${DB_NAME:-app}
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	for key, want := range map[string]string{
+		"mysql.user":     "from-environment",
+		"mysql.password": "from dotenv",
+		"mysql.database": "app",
+		"project":        "demo",
+	} {
+		if got := viper.GetString(key); got != want {
+			t.Errorf("Expected %s to be %q, got %q", key, want, got)
+		}
+	}
+
+	writeConfigFile(t, "upctl.yaml", "mysql:\n  password: ${MISSING_PASSWORD}\n")
+	if err := readConfig(""); err == nil || !strings.Contains(err.Error(), "${MISSING_PASSWORD} in mysql.password") {
+		t.Errorf("Expected an error listing the unresolved variable, got %v", err)
+	}
+}
+
+func TestReadConfig_DotEnvDollar(t *testing.T) {
+	setup(t)
+	defer teardown()
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+	chdir(t, project)
+
+	writeConfigFile(t, filepath.Join(project, ".env"), "PW='a$bc'\n")
+	writeConfigFile(t, "upctl.yaml", `
+mysql:
+  password: ${PW}
+services:
+  mysql:
+    image: mysql:8.0
+    environment:
+      MYSQL_ROOT_PASSWORD: ${PW}
+volumes:
+  share:
+    driver_opts:
+      password: ${PW}
+      sshcmd: app@$$HOST
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	if got := viper.GetString("mysql.password"); got != "a$bc" {
+		t.Errorf("Expected mysql.password to be 'a$bc', got %q", got)
+	}
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	// Docker Compose reads $$ back as $.
+	if got, _ := cfg.Services["mysql"].Environment.Get("MYSQL_ROOT_PASSWORD"); got != "a$$bc" {
+		t.Errorf("Expected the $ to be escaped for Docker Compose, got %q", got)
+	}
+	opts, _ := cfg.Volumes["share"].(map[string]interface{})["driver_opts"].(map[string]interface{})
+	if opts["password"] != "a$$bc" || opts["sshcmd"] != "app@$$HOST" {
+		t.Errorf("Expected the $ in volumes to be escaped for Docker Compose too, got %v", opts)
+	}
+}
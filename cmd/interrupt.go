@@ -0,0 +1,37 @@
+package cmd
+
+import "sync"
+
+var (
+	interruptMu       sync.Mutex
+	interruptCleanups = make(map[int]func())
+	nextCleanupID     int
+)
+
+// onInterrupt registers fn to run if upctl is interrupted before the returned
+// function is called. Commands use it to remove partial files.
+func onInterrupt(fn func()) (unregister func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	id := nextCleanupID
+	nextCleanupID++
+	interruptCleanups[id] = fn
+	return func() {
+		interruptMu.Lock()
+		defer interruptMu.Unlock()
+		delete(interruptCleanups, id)
+	}
+}
+
+// RunInterruptCleanups runs the cleanups registered by the running command, newest
+// first. It is called when upctl receives SIGINT or SIGTERM, before it exits.
+func RunInterruptCleanups() {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	for id := nextCleanupID - 1; id >= 0; id-- {
+		if fn, ok := interruptCleanups[id]; ok {
+			delete(interruptCleanups, id)
+			fn()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PostImportHook is SQL run in a database after its dump was imported, e.g. to
+// reset passwords or anonymise a production-derived dump. Exactly one of File and
+// SQL is set.
+type PostImportHook struct {
+	File string `mapstructure:"file"`
+	SQL  string `mapstructure:"sql"`
+}
+
+// String describes the hook in messages.
+func (h PostImportHook) String() string {
+	if h.File != "" {
+		return "file " + h.File
+	}
+	sql := strings.Join(strings.Fields(h.SQL), " ")
+	if len(sql) > 60 {
+		sql = sql[:57] + "..."
+	}
+	return fmt.Sprintf("sql '%s'", sql)
+}
+
+// validatePostImportHooks checks that every hook of a target has either a file or SQL.
+func validatePostImportHooks(target DatabaseTarget) error {
+	for i, hook := range target.PostImport {
+		if (hook.File == "") == (strings.TrimSpace(hook.SQL) == "") {
+			return configError(nil, "post_import hook %d of database '%s' needs exactly one of 'file' and 'sql'", i+1, target.Name)
+		}
+	}
+	return nil
+}
+
+// runPostImportHooks runs the post-import hooks of a target in order, piping each
+// one into the database client inside the target's service. The first failing
+// hook stops the rest.
+func runPostImportHooks(rt Runtime, target DatabaseTarget) error {
+	for i, hook := range target.PostImport {
+		fmt.Printf("Running post-import hook %d/%d of database %s (%s)...\n", i+1, len(target.PostImport), target.Name, hook)
+		if err := runPostImportHook(rt, target, hook); err != nil {
+			return toolError(err, "post-import hook %d of database '%s' (%s) failed", i+1, target.Name, hook)
+		}
+	}
+	return nil
+}
+
+func runPostImportHook(rt Runtime, target DatabaseTarget, hook PostImportHook) error {
+	var sql io.Reader = strings.NewReader(hook.SQL + "\n")
+	if hook.File != "" {
+		path, err := cleanPath(hook.File)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sql = file
+	}
+	clientCmd, env := databaseEngines[target.Engine].importCommand(target, nil)
+	return rt.Exec(target.Service, clientCmd, CommandIO{Stdin: sql, Env: env})
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestImportDatabases_PostImportHooks(t *testing.T) {
+	setup(t)
+	defer teardown()
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "app.sql")
+	hookFile := filepath.Join(dir, "anonymise.sql")
+	os.WriteFile(dump, []byte("-- dump\n"), 0600)
+	os.WriteFile(hookFile, []byte("UPDATE users SET email = CONCAT('user', id, '@example.com');\n"), 0600)
+
+	target := DatabaseTarget{Name: "app", Service: "mysql", Engine: engineMySQL, User: "app", Database: "app", PostImport: []PostImportHook{
+		{SQL: "UPDATE users SET password = 'dev';"},
+		{File: hookFile},
+		{SQL: "UPDATE webhooks SET enabled = 0;"},
+	}}
+
+	rt := &fakeRuntime{}
+	if err := importDatabases(rt, []DatabaseTarget{target}, map[string]string{"app": dump}); err != nil {
+		t.Fatalf("importDatabases() returned an error: %v", err)
+	}
+	want := "-- dump\nUPDATE users SET password = 'dev';\nUPDATE users SET email = CONCAT('user', id, '@example.com');\nUPDATE webhooks SET enabled = 0;\n"
+	if string(rt.stdin) != want {
+		t.Errorf("Expected the dump and then the hooks in order, got %q", rt.stdin)
+	}
+	for i, call := range rt.services {
+		if rt.calls[i] != "exec" || call[0] != "mysql" || call[1] != "mysql" {
+			t.Errorf("Expected every hook to run through the mysql client in the mysql service, got %v", call)
+		}
+	}
+
+	// A failing hook stops the rest and is named in the error.
+	rt = &fakeRuntime{execFailOn: "email"}
+	err := importDatabases(rt, []DatabaseTarget{target}, map[string]string{"app": dump})
+	if ExitCode(err) != ExitToolFailed || !strings.Contains(err.Error(), "post-import hook 2 of database 'app' (file "+hookFile+")") {
+		t.Errorf("Expected hook 2 to be reported as failed, got %v", err)
+	}
+	if strings.Contains(string(rt.stdin), "webhooks") {
+		t.Errorf("Expected the hooks after the failing one not to run")
+	}
+}
+
+func TestLoadDatabaseTargets_InvalidPostImportHook(t *testing.T) {
+	setup(t)
+	defer teardown()
+	viper.Set("databases", []map[string]interface{}{
+		{"name": "app", "service": "mysql", "post_import": []map[string]interface{}{{"sql": "SELECT 1"}, {"file": "a.sql", "sql": "SELECT 2"}}},
+	})
+	if _, err := loadDatabaseTargets(); ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "post_import hook 2 of database 'app'") {
+		t.Errorf("Expected a config error for the second hook, got %v", err)
+	}
+}
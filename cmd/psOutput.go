@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output modes of 'upctl ps'.
+const (
+	psOutputTable = "table"
+	psOutputWide  = "wide"
+	psOutputJSON  = "json"
+	psOutputYAML  = "yaml"
+)
+
+// ServiceStatus is the merged view of a configured service and its container as shown by 'upctl ps'.
+type ServiceStatus struct {
+	Service    string          `json:"service" yaml:"service"`
+	Running    bool            `json:"running" yaml:"running"`
+	Status     string          `json:"status" yaml:"status"`
+	Container  string          `json:"container,omitempty" yaml:"container,omitempty"`
+	Image      string          `json:"image,omitempty" yaml:"image,omitempty"`
+	Command    string          `json:"command,omitempty" yaml:"command,omitempty"`
+	State      string          `json:"state,omitempty" yaml:"state,omitempty"`
+	Health     string          `json:"health,omitempty" yaml:"health,omitempty"`
+	ExitCode   int             `json:"exitCode" yaml:"exitCode"`
+	Publishers []PublishedPort `json:"publishers" yaml:"publishers"`
+}
+
+// PublishedPort is a container port published on the host.
+type PublishedPort struct {
+	URL           string `json:"url" yaml:"url"`
+	TargetPort    int    `json:"targetPort" yaml:"targetPort"`
+	PublishedPort int    `json:"publishedPort" yaml:"publishedPort"`
+	Protocol      string `json:"protocol" yaml:"protocol"`
+}
+
+// String formats the port the way docker does, e.g. "0.0.0.0:8080->80/tcp".
+func (p PublishedPort) String() string {
+	// Ensure URL is not empty for better display, default to 0.0.0.0 if common
+	url := p.URL
+	if url == "" || url == "::" { // Docker might use "::" for IPv6 all interfaces
+		url = "0.0.0.0"
+	}
+	return fmt.Sprintf("%s:%d->%d/%s", url, p.PublishedPort, p.TargetPort, p.Protocol)
+}
+
+// newServiceStatus merges a configured service with its 'compose ps' entry, if one
+// was found. Stopped and exited containers keep their state and exit code; only a
+// running container is shown as Running.
+func newServiceStatus(serviceName string, details DockerPsJSONEntry, found bool) ServiceStatus {
+	isRunning := found && (details.State == "" || details.State == "running")
+	status := ServiceStatus{
+		Service:    serviceName,
+		Running:    isRunning,
+		Status:     "Not Running",
+		Publishers: []PublishedPort{},
+	}
+	if !found {
+		return status
+	}
+	if isRunning {
+		status.Status = "Running"
+	}
+	status.Container = details.Name
+	status.Image = details.Image
+	status.Command = details.Command
+	status.State = details.State
+	if status.State == "" {
+		status.State = details.Status
+	}
+	status.Health = details.Health
+	status.ExitCode = details.ExitCode
+	for _, p := range details.Publishers {
+		status.Publishers = append(status.Publishers, PublishedPort{
+			URL:           p.URL,
+			TargetPort:    p.TargetPort,
+			PublishedPort: p.PublishedPort,
+			Protocol:      p.Protocol,
+		})
+	}
+	return status
+}
+
+// validatePsOutput checks the --output and --format flags before anything is run.
+func validatePsOutput(output string, format string) error {
+	switch output {
+	case "", psOutputTable, psOutputWide, psOutputJSON, psOutputYAML:
+	default:
+		return usageError("invalid --output '%s', expected one of: %s, %s, %s, %s", output, psOutputTable, psOutputWide, psOutputJSON, psOutputYAML)
+	}
+	if format != "" {
+		if output != "" && output != psOutputTable {
+			return usageError("--format cannot be combined with --output %s", output)
+		}
+		if _, err := template.New("format").Parse(format); err != nil {
+			return usageError("invalid --format template: %s", err)
+		}
+	}
+	return nil
+}
+
+// renderServiceStatuses writes the statuses in the requested output mode or Go template.
+func renderServiceStatuses(w io.Writer, statuses []ServiceStatus, output string, format string) error {
+	if format != "" {
+		return renderServiceStatusTemplate(w, statuses, format)
+	}
+	switch output {
+	case psOutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	case psOutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(statuses); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case psOutputWide:
+		return renderServiceStatusTable(w, statuses, true)
+	default:
+		return renderServiceStatusTable(w, statuses, false)
+	}
+}
+
+// renderServiceStatusTemplate executes a Go template once per service, like 'docker ps --format'.
+func renderServiceStatusTemplate(w io.Writer, statuses []ServiceStatus, format string) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"join": joinValues,
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return usageError("invalid --format template: %s", err)
+	}
+	for _, status := range statuses {
+		if err := tmpl.Execute(w, status); err != nil {
+			return usageError("error executing --format template: %s", err)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// joinValues joins the elements of any slice, formatting each with fmt, so that
+// templates can join both strings and publishers: {{join .Publishers ", "}}.
+func joinValues(values interface{}, sep string) (string, error) {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join expects a list, got %T", values)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// truncate shortens s to max characters, marking the cut with "...".
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
+
+// dash returns "-" for empty values so that table columns stay aligned.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// renderServiceStatusTable writes the statuses as a table whose columns are sized
+// from the data. Long image, command and state values are shortened unless wide is set.
+func renderServiceStatusTable(w io.Writer, statuses []ServiceStatus, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	header := []string{"CONFIG SERVICE", "STATUS", "NAME", "IMAGE", "COMMAND", "STATE"}
+	if wide {
+		header = append(header, "HEALTH", "EXIT CODE")
+	}
+	header = append(header, "PORTS")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, status := range statuses {
+		var ports []string
+		for _, p := range status.Publishers {
+			ports = append(ports, p.String())
+		}
+
+		image, command, state := status.Image, status.Command, status.State
+		if !wide {
+			image = truncate(image, 24)
+			command = truncate(command, 20)
+			state = truncate(state, 17)
+		}
+		row := []string{status.Service, status.Status, dash(status.Container), dash(image), dash(command), dash(state)}
+		if wide {
+			exitCode := "-"
+			if status.Container != "" && !status.Running {
+				exitCode = fmt.Sprintf("%d", status.ExitCode)
+			}
+			row = append(row, dash(status.Health), exitCode)
+		}
+		row = append(row, dash(strings.Join(ports, ", ")))
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func testServiceStatuses() []ServiceStatus {
+	running := newServiceStatus("web", DockerPsJSONEntry{
+		Name:       "upctl-web-1",
+		Image:      "registry.example.com/team/very-long-image-name:1.2.3",
+		Command:    "/docker-entrypoint.sh nginx -g 'daemon off;'",
+		State:      "running",
+		Health:     "healthy",
+		Publishers: []PsPublisher{{URL: "0.0.0.0", TargetPort: 80, PublishedPort: 8080, Protocol: "tcp"}, {URL: "::", TargetPort: 443, PublishedPort: 8443, Protocol: "tcp"}},
+	}, true)
+	stopped := newServiceStatus("db", DockerPsJSONEntry{}, false)
+	return []ServiceStatus{stopped, running}
+}
+
+func TestNewServiceStatus_Exited(t *testing.T) {
+	status := newServiceStatus("worker", DockerPsJSONEntry{
+		Name:     "upctl-worker-1",
+		Image:    "worker:1.0",
+		State:    "exited",
+		Health:   "unhealthy",
+		ExitCode: 137,
+	}, true)
+	if status.Running || status.Status != "Not Running" {
+		t.Errorf("Expected an exited container not to be running, got %+v", status)
+	}
+	if status.Container != "upctl-worker-1" || status.State != "exited" || status.Health != "unhealthy" || status.ExitCode != 137 {
+		t.Errorf("Expected the container, state, health and exit code of the exited container, got %+v", status)
+	}
+}
+
+func TestRenderServiceStatuses_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderServiceStatuses(&buf, testServiceStatuses(), psOutputJSON, ""); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+
+	var decoded []ServiceStatus
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(decoded) != 2 || decoded[1].Image != "registry.example.com/team/very-long-image-name:1.2.3" {
+		t.Errorf("Expected untruncated image in JSON output, got %+v", decoded)
+	}
+	if len(decoded[1].Publishers) != 2 || decoded[1].Health != "healthy" {
+		t.Errorf("Expected all publishers and health in JSON output, got %+v", decoded[1])
+	}
+	if decoded[0].Running || decoded[0].Status != "Not Running" {
+		t.Errorf("Expected db to be not running, got %+v", decoded[0])
+	}
+}
+
+func TestRenderServiceStatuses_YAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderServiceStatuses(&buf, testServiceStatuses(), psOutputYAML, ""); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+	var decoded []map[string]interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid YAML: %v\n%s", err, buf.String())
+	}
+	if len(decoded) != 2 || decoded[1]["service"] != "web" || decoded[1]["command"] != "/docker-entrypoint.sh nginx -g 'daemon off;'" {
+		t.Errorf("Unexpected YAML output: %v", decoded)
+	}
+}
+
+func TestRenderServiceStatuses_Table(t *testing.T) {
+	var table, wide bytes.Buffer
+	if err := renderServiceStatuses(&table, testServiceStatuses(), psOutputTable, ""); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+	if err := renderServiceStatuses(&wide, testServiceStatuses(), psOutputWide, ""); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+
+	if strings.Contains(table.String(), "very-long-image-name:1.2.3") || !strings.Contains(table.String(), "...") {
+		t.Errorf("Expected long values to be truncated in the table output:\n%s", table.String())
+	}
+	if !strings.Contains(wide.String(), "registry.example.com/team/very-long-image-name:1.2.3") || !strings.Contains(wide.String(), "HEALTH") {
+		t.Errorf("Expected full values and health column in the wide output:\n%s", wide.String())
+	}
+	if !strings.Contains(wide.String(), "0.0.0.0:8080->80/tcp, 0.0.0.0:8443->443/tcp") {
+		t.Errorf("Expected all publishers in the wide output:\n%s", wide.String())
+	}
+
+	// Columns are sized from the data: every row starts its STATUS column at the same offset.
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	offset := strings.Index(lines[0], "STATUS")
+	for _, line := range lines[1:] {
+		if idx := strings.Index(line, "Running"); idx != offset && strings.Index(line, "Not Running") != offset {
+			t.Errorf("STATUS column not aligned at %d in line %q", offset, line)
+		}
+	}
+}
+
+func TestRenderServiceStatuses_WideExitCode(t *testing.T) {
+	exited := newServiceStatus("worker", DockerPsJSONEntry{Name: "upctl-worker-1", Image: "worker:1.0", State: "exited", ExitCode: 137}, true)
+	statuses := append(testServiceStatuses(), exited)
+	var buf bytes.Buffer
+	if err := renderServiceStatuses(&buf, statuses, psOutputWide, ""); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	column := strings.Index(lines[0], "EXIT CODE")
+	want := map[string]string{"db": "-", "web": "-", "worker": "137"}
+	for _, line := range lines[1:] {
+		service := strings.Fields(line)[0]
+		if got := strings.Fields(line[column:])[0]; got != want[service] {
+			t.Errorf("Expected exit code %q for %s, got %q in line %q", want[service], service, got, line)
+		}
+	}
+}
+
+func TestRenderServiceStatuses_Template(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderServiceStatuses(&buf, testServiceStatuses(), "", "{{.Service}}={{.Status}}"); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+	if buf.String() != "db=Not Running\nweb=Running\n" {
+		t.Errorf("Unexpected template output: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderServiceStatuses(&buf, testServiceStatuses()[1:], "", `{{.Service}} {{join .Publishers ", "}}`); err != nil {
+		t.Fatalf("renderServiceStatuses() returned an error: %v", err)
+	}
+	if buf.String() != "web 0.0.0.0:8080->80/tcp, 0.0.0.0:8443->443/tcp\n" {
+		t.Errorf("Unexpected template output for join: %q", buf.String())
+	}
+}
+
+func TestValidatePsOutput(t *testing.T) {
+	if err := validatePsOutput("xml", ""); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for an unknown output, got %v", err)
+	}
+	if err := validatePsOutput(psOutputJSON, "{{.Service}}"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error when combining --format and --output json, got %v", err)
+	}
+	if err := validatePsOutput("", "{{.Service"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for an invalid template, got %v", err)
+	}
+	if err := validatePsOutput(psOutputTable, "{{.Service}}"); err != nil {
+		t.Errorf("Expected --format with the default output to be valid, got %v", err)
+	}
+}
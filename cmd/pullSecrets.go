@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// serviceAccountAttempts is how often the default service account of a namespace
+// is looked up; Kubernetes creates it shortly after the namespace.
+const serviceAccountAttempts = 10
+
+// dockerConfigJSON renders the .dockerconfigjson of an image pull secret holding
+// the credentials of every registry in auths, on top of the entries in keep.
+func dockerConfigJSON(auths []registryAuth, keep map[string]json.RawMessage) ([]byte, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	config := struct {
+		Auths map[string]interface{} `json:"auths"`
+	}{Auths: make(map[string]interface{}, len(auths)+len(keep))}
+	for registry, existing := range keep {
+		config.Auths[registry] = existing
+	}
+	for _, a := range auths {
+		config.Auths[a.Registry] = entry{
+			Username: a.Username,
+			Password: a.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password)),
+		}
+	}
+	return json.Marshal(config)
+}
+
+// pullSecretAuths returns the registry entries of the .dockerconfigjson of an
+// image pull secret, or nil when the secret doesn't exist.
+func pullSecretAuths(kubectl, namespace, secret string) (map[string]json.RawMessage, error) {
+	output, err := CaptureCommand(kubectl, "get", "secret", secret, "--namespace", namespace, "--ignore-not-found", "--output", "json")
+	if err != nil || strings.TrimSpace(output) == "" {
+		return nil, err
+	}
+	var manifest struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(output), &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing secret '%s': %w", secret, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(manifest.Data[".dockerconfigjson"])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding secret '%s': %w", secret, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing the .dockerconfigjson of secret '%s': %w", secret, err)
+	}
+	return config.Auths, nil
+}
+
+// kubectlApply applies a manifest with 'kubectl apply -f -'. The manifest goes
+// through stdin, so secrets in it never show up in the process list.
+func kubectlApply(kubectl string, manifest interface{}) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return StreamCommand(CommandIO{Stdin: strings.NewReader(string(data))}, kubectl, "apply", "-f", "-")
+}
+
+// addImagePullSecret adds secret to the imagePullSecrets of the default service
+// account of namespace, keeping the secrets it already has.
+func addImagePullSecret(kubectl, namespace, secret string) error {
+	var output string
+	var err error
+	for attempt := 1; attempt <= serviceAccountAttempts; attempt++ {
+		output, err = CaptureCommand(kubectl, "get", "serviceaccount", "default", "--namespace", namespace, "--output", "json")
+		if err == nil || attempt == serviceAccountAttempts {
+			break
+		}
+		time.Sleep(waitPollInterval)
+	}
+	if err != nil {
+		return err
+	}
+
+	var account struct {
+		ImagePullSecrets []struct {
+			Name string `json:"name"`
+		} `json:"imagePullSecrets"`
+	}
+	if err := json.Unmarshal([]byte(output), &account); err != nil {
+		return fmt.Errorf("error parsing the default service account: %w", err)
+	}
+	for _, existing := range account.ImagePullSecrets {
+		if existing.Name == secret {
+			return nil
+		}
+	}
+
+	// A JSON patch appends to the list; a merge patch would replace the secrets already there.
+	patch := fmt.Sprintf(`[{"op":"add","path":"/imagePullSecrets/-","value":{"name":%q}}]`, secret)
+	if account.ImagePullSecrets == nil {
+		patch = fmt.Sprintf(`[{"op":"add","path":"/imagePullSecrets","value":[{"name":%q}]}]`, secret)
+	}
+	return ExecuteCommand(kubectl, "patch", "serviceaccount", "default", "--namespace", namespace, "--type", "json", "--patch", patch)
+}
+
+// configDockerKubernetes logs Docker into the named registries, or all of them, and
+// stores the same credentials in the image pull secret docker_config.name in every
+// namespace in docker_config.namespaces of the current kubectl context. Missing
+// namespaces are created, and the secret is added to the imagePullSecrets of each
+// namespace's default service account. When registries are named, the credentials
+// of other registries already in a secret are kept; otherwise the secret is
+// replaced, dropping registries that are no longer configured.
+func configDockerKubernetes(names []string) error {
+	if dockerConfig.Name == "" {
+		return configError(nil, "docker_config.name must name the image pull secret")
+	}
+	if len(dockerConfig.Namespaces) == 0 {
+		return configError(nil, "docker_config.namespaces must list the namespaces to create the image pull secret in")
+	}
+	kubectl, err := lookPath("kubectl")
+	if err != nil {
+		return err
+	}
+	registries, err := selectRegistries(names)
+	if err != nil {
+		return err
+	}
+
+	var auths []registryAuth
+	for _, reg := range registries {
+		progress.Restart()
+		auth, err := loginRegistry(reg)
+		if err != nil {
+			return err
+		}
+		auths = append(auths, auth)
+	}
+
+	for _, namespace := range dockerConfig.Namespaces {
+		progress.Restart()
+		fmt.Printf("Configuring image pull secret %s in namespace %s...\n", dockerConfig.Name, namespace)
+		if err := kubectlApply(kubectl, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]string{"name": namespace},
+		}); err != nil {
+			return toolError(err, "error creating namespace '%s'", namespace)
+		}
+		var keep map[string]json.RawMessage
+		if len(names) > 0 {
+			if keep, err = pullSecretAuths(kubectl, namespace, dockerConfig.Name); err != nil {
+				return toolError(err, "error reading image pull secret '%s' in namespace '%s'", dockerConfig.Name, namespace)
+			}
+		}
+		configJSON, err := dockerConfigJSON(auths, keep)
+		if err != nil {
+			return err
+		}
+		if err := kubectlApply(kubectl, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       "kubernetes.io/dockerconfigjson",
+			"metadata":   map[string]string{"name": dockerConfig.Name, "namespace": namespace},
+			"data":       map[string]string{".dockerconfigjson": base64.StdEncoding.EncodeToString(configJSON)},
+		}); err != nil {
+			return toolError(err, "error creating image pull secret '%s' in namespace '%s'", dockerConfig.Name, namespace)
+		}
+		if err := addImagePullSecret(kubectl, namespace, dockerConfig.Name); err != nil {
+			return toolError(err, "error adding image pull secret '%s' to the default service account of namespace '%s'", dockerConfig.Name, namespace)
+		}
+	}
+	fmt.Printf("Image pull secret %s configured in namespace(s) %s\n", dockerConfig.Name, strings.Join(dockerConfig.Namespaces, ", "))
+	return nil
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConfigDockerKubernetes(t *testing.T) {
+	setup(t)
+	defer teardown()
+	fakeTools(t, "kubectl")
+	recordAllCommands(t)
+	serviceAccounts := map[string]string{
+		"default": `{"imagePullSecrets": [{"name": "other"}]}`,
+		"team":    `{"metadata": {"name": "default"}}`,
+		"ops":     `{"imagePullSecrets": [{"name": "regcred"}]}`,
+	}
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		return serviceAccounts[args[len(args)-3]], nil
+	}
+	t.Setenv("GHCR_TOKEN", testSecret)
+	originalDocker := dockerConfig
+	defer func() { dockerConfig = originalDocker }()
+	dockerConfig = DockerConfig{
+		Name:       "regcred",
+		Namespaces: []string{"default", "team", "ops"},
+		Registries: []RegistryConfig{
+			{Name: "ghcr", Registry: "ghcr.io", Auth: authEnv, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+			{Name: "hub", Registry: "docker.io", Username: "hub-user", Password: "hub-pwd"},
+		},
+	}
+
+	if err := configDockerKubernetes(nil); err != nil {
+		t.Fatalf("configDockerKubernetes() returned an error: %v", err)
+	}
+	assertSecretNotInArgs(t, testSecret)
+
+	var secrets, namespaces int
+	patches := make(map[string]string)
+	for _, call := range mockExecuteTracker {
+		args := strings.Join(call.Args, " ")
+		switch {
+		case args == "apply -f -" && strings.Contains(call.Stdin, `"kind":"Namespace"`):
+			namespaces++
+		case args == "apply -f -" && strings.Contains(call.Stdin, `"kind":"Secret"`):
+			secrets++
+			var secret struct {
+				Type string            `json:"type"`
+				Data map[string]string `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(call.Stdin), &secret); err != nil {
+				t.Fatalf("Invalid secret manifest: %v", err)
+			}
+			configJSON, _ := base64.StdEncoding.DecodeString(secret.Data[".dockerconfigjson"])
+			var config struct {
+				Auths map[string]struct{ Username, Password, Auth string } `json:"auths"`
+			}
+			json.Unmarshal(configJSON, &config)
+			ghcr := config.Auths["ghcr.io"]
+			if secret.Type != "kubernetes.io/dockerconfigjson" || ghcr.Password != testSecret || config.Auths["docker.io"].Username != "hub-user" ||
+				ghcr.Auth != base64.StdEncoding.EncodeToString([]byte("me:"+testSecret)) {
+				t.Errorf("Unexpected pull secret %s", configJSON)
+			}
+		case strings.HasPrefix(args, "patch serviceaccount default"):
+			patches[call.Args[4]] = call.Args[len(call.Args)-1]
+		}
+	}
+	if namespaces != 3 || secrets != 3 {
+		t.Errorf("Expected a namespace and a secret to be applied in each of the 3 namespaces, got %d and %d", namespaces, secrets)
+	}
+	want := map[string]string{
+		"default": `[{"op":"add","path":"/imagePullSecrets/-","value":{"name":"regcred"}}]`,
+		"team":    `[{"op":"add","path":"/imagePullSecrets","value":[{"name":"regcred"}]}]`,
+	}
+	if len(patches) != len(want) || patches["default"] != want["default"] || patches["team"] != want["team"] {
+		t.Errorf("Expected the service accounts of default and team to be patched, got %v", patches)
+	}
+
+	dockerConfig.Namespaces = nil
+	if err := configDockerKubernetes(nil); ExitCode(err) != ExitConfig {
+		t.Errorf("Expected a config error without namespaces, got %v", err)
+	}
+}
+
+func TestConfigDockerKubernetes_KeepsOtherRegistries(t *testing.T) {
+	setup(t)
+	defer teardown()
+	fakeTools(t, "kubectl")
+	recordAllCommands(t)
+	existing := base64.StdEncoding.EncodeToString([]byte(`{"auths": {"ghcr.io": {"username": "me", "password": "old"}, "quay.io": {"auth": "cXVheTpwd2Q="}}}`))
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		if args[1] == "secret" {
+			return `{"data": {".dockerconfigjson": "` + existing + `"}}`, nil
+		}
+		return `{"imagePullSecrets": [{"name": "regcred"}]}`, nil
+	}
+	t.Setenv("GHCR_TOKEN", testSecret)
+	originalDocker := dockerConfig
+	defer func() { dockerConfig = originalDocker }()
+	dockerConfig = DockerConfig{
+		Name:       "regcred",
+		Namespaces: []string{"default"},
+		Registries: []RegistryConfig{
+			{Name: "ghcr", Registry: "ghcr.io", Auth: authEnv, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+			{Name: "hub", Registry: "docker.io", Username: "hub-user", Password: "hub-pwd"},
+		},
+	}
+
+	if err := configDockerKubernetes([]string{"ghcr"}); err != nil {
+		t.Fatalf("configDockerKubernetes() returned an error: %v", err)
+	}
+	var applied bool
+	for _, call := range mockExecuteTracker {
+		if !strings.Contains(call.Stdin, `"kind":"Secret"`) {
+			continue
+		}
+		applied = true
+		var secret struct {
+			Data map[string]string `json:"data"`
+		}
+		json.Unmarshal([]byte(call.Stdin), &secret)
+		configJSON, _ := base64.StdEncoding.DecodeString(secret.Data[".dockerconfigjson"])
+		var config struct {
+			Auths map[string]struct{ Username, Password, Auth string } `json:"auths"`
+		}
+		json.Unmarshal(configJSON, &config)
+		if config.Auths["ghcr.io"].Password != testSecret {
+			t.Errorf("Expected the named registry to be updated, got %s", configJSON)
+		}
+		if config.Auths["quay.io"].Auth != "cXVheTpwd2Q=" {
+			t.Errorf("Expected the other registries in the secret to be kept, got %s", configJSON)
+		}
+		if _, ok := config.Auths["docker.io"]; ok {
+			t.Errorf("Expected only the named registry to be logged into, got %s", configJSON)
+		}
+	}
+	if !applied {
+		t.Errorf("Expected the pull secret to be applied")
+	}
+}
@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ecrTokenLifetime is how long an ECR login password stays valid.
+const ecrTokenLifetime = 12 * time.Hour
+
+// registryLoginMargin renews a registry login this long before it expires, so that
+// it doesn't run out halfway through pulling images.
+const registryLoginMargin = 10 * time.Minute
+
+// registryLoginsFile is the file in ~/.upctl/state recording registry logins. Docker
+// credentials are shared by all projects, so the file is too.
+const registryLoginsFile = "registry-logins.json"
+
+// ecrHostPattern matches ECR registry hostnames and captures their region, e.g.
+// 123456789012.dkr.ecr.eu-west-1.amazonaws.com.
+var ecrHostPattern = regexp.MustCompile(`^[0-9]+\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// registryHost returns the hostname of a registry address, without a scheme or path.
+func registryHost(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host, _, _ := strings.Cut(registry, "/")
+	return host
+}
+
+// Auth modes of a registry.
+const (
+	// authStatic logs in with the username and password in upctl.yaml.
+	authStatic = "static"
+	// authEnv logs in with a password read from the environment variable password_env.
+	authEnv = "env"
+	// authTeleportECR logs into ECR with a token from the Teleport AWS app.
+	authTeleportECR = "teleport-ecr"
+	// authAWSECR logs into ECR with a token from the aws CLI.
+	authAWSECR = "aws-ecr"
+	// authHelper logs in with the credentials of a Docker credential helper,
+	// docker-credential-<helper>.
+	authHelper = "helper"
+)
+
+// RegistryConfig is a container registry from docker_config.registries.
+type RegistryConfig struct {
+	Name        string `mapstructure:"name"`
+	Registry    string `mapstructure:"registry"`
+	Auth        string `mapstructure:"auth"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	PasswordEnv string `mapstructure:"password_env"`
+	AWSApp      string `mapstructure:"aws_app"`
+	Region      string `mapstructure:"region"`
+	Profile     string `mapstructure:"profile"`
+	Helper      string `mapstructure:"helper"`
+}
+
+// expires reports whether logins to the registry only last a while, as ECR tokens do.
+func (r RegistryConfig) expires() bool {
+	return r.Auth == authTeleportECR || r.Auth == authAWSECR
+}
+
+// legacyRegistry turns the single registry described by the top level fields of
+// docker_config into a registry named "default".
+func legacyRegistry(cfg DockerConfig) RegistryConfig {
+	reg := RegistryConfig{
+		Name:     "default",
+		Registry: cfg.Registry,
+		Auth:     authStatic,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		AWSApp:   cfg.AWSApp,
+		Region:   cfg.Region,
+	}
+	if cfg.UseTeleport {
+		reg.Auth = authTeleportECR
+	}
+	return reg
+}
+
+// loadRegistries returns the registries of docker_config, checking that each one
+// has what its auth mode needs. ECR registries default to the username "AWS".
+func loadRegistries(cfg DockerConfig) ([]RegistryConfig, error) {
+	registries := cfg.Registries
+	if len(registries) == 0 {
+		if cfg.Registry == "" {
+			return nil, nil
+		}
+		registries = []RegistryConfig{legacyRegistry(cfg)}
+	}
+
+	seen := make(map[string]bool, len(registries))
+	result := make([]RegistryConfig, 0, len(registries))
+	for _, reg := range registries {
+		if reg.Name == "" || reg.Registry == "" {
+			return nil, configError(nil, "every registry in docker_config.registries needs a name and a registry")
+		}
+		if seen[reg.Name] {
+			return nil, configError(nil, "registry '%s' is defined more than once", reg.Name)
+		}
+		seen[reg.Name] = true
+		if reg.Auth == "" {
+			reg.Auth = authStatic
+		}
+		if reg.expires() && reg.Username == "" {
+			reg.Username = "AWS"
+		}
+
+		var missing string
+		switch reg.Auth {
+		case authStatic:
+		case authEnv:
+			if reg.PasswordEnv == "" {
+				missing = "password_env"
+			}
+		case authTeleportECR:
+			if reg.AWSApp == "" {
+				missing = "aws_app"
+			}
+		case authAWSECR:
+		case authHelper:
+			if reg.Helper == "" {
+				missing = "helper"
+			}
+		default:
+			return nil, configError(nil, "registry '%s' has unsupported auth '%s'; use %s, %s, %s, %s or %s",
+				reg.Name, reg.Auth, authStatic, authEnv, authTeleportECR, authAWSECR, authHelper)
+		}
+		if missing != "" {
+			return nil, configError(nil, "registry '%s' with auth '%s' needs '%s'", reg.Name, reg.Auth, missing)
+		}
+		result = append(result, reg)
+	}
+	return result, nil
+}
+
+// selectRegistries returns the registries named in names, or all of them without names.
+func selectRegistries(names []string) ([]RegistryConfig, error) {
+	registries, err := loadRegistries(dockerConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(registries) == 0 {
+		return nil, configError(nil, "no registry is configured in docker_config")
+	}
+	if len(names) == 0 {
+		return registries, nil
+	}
+	byName := make(map[string]RegistryConfig, len(registries))
+	available := make([]string, 0, len(registries))
+	for _, reg := range registries {
+		byName[reg.Name] = reg
+		available = append(available, reg.Name)
+	}
+	var selected []RegistryConfig
+	var unknown []string
+	for _, name := range names {
+		reg, ok := byName[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected = append(selected, reg)
+	}
+	if len(unknown) > 0 {
+		return nil, notFoundError("registry(s)", unknown, available)
+	}
+	return selected, nil
+}
+
+// ecrRegion returns the AWS region of an ECR registry: its configured region, else
+// the region in the registry hostname, else teleport.aws_region.
+func ecrRegion(reg RegistryConfig) (string, error) {
+	if reg.Region != "" {
+		return reg.Region, nil
+	}
+	if m := ecrHostPattern.FindStringSubmatch(registryHost(reg.Registry)); m != nil {
+		return m[1], nil
+	}
+	if teleportConfig.AWSRegion != "" {
+		return teleportConfig.AWSRegion, nil
+	}
+	return "", configError(nil, "cannot tell the AWS region of registry '%s'; set its region", reg.Name)
+}
+
+// registryCredentials returns the username and password to log into reg with, and
+// when they expire; the expiry is zero for credentials that don't.
+func registryCredentials(reg RegistryConfig, now time.Time) (string, string, time.Time, error) {
+	switch reg.Auth {
+	case authEnv:
+		password, ok := os.LookupEnv(reg.PasswordEnv)
+		if !ok || password == "" {
+			return "", "", time.Time{}, configError(nil, "environment variable %s of registry '%s' is not set", reg.PasswordEnv, reg.Name)
+		}
+		return reg.Username, password, time.Time{}, nil
+
+	case authTeleportECR, authAWSECR:
+		region, err := ecrRegion(reg)
+		if err != nil {
+			return "", "", time.Time{}, err
+		}
+		var password string
+		if reg.Auth == authTeleportECR {
+			if err := (&teleportSession{}).app(reg.AWSApp); err != nil {
+				return "", "", time.Time{}, err
+			}
+			password, err = tshAwsEcrLogin(reg.AWSApp, region)
+		} else {
+			password, err = awsEcrLogin(reg.Profile, region)
+		}
+		if err != nil {
+			return "", "", time.Time{}, toolError(err, "error getting the ECR login password of registry '%s'", reg.Name)
+		}
+		// The token's lifetime starts no later than now, so expiry is counted from there.
+		return reg.Username, password, now.Add(ecrTokenLifetime), nil
+
+	case authHelper:
+		helper, err := lookPath("docker-credential-" + reg.Helper)
+		if err != nil {
+			return "", "", time.Time{}, err
+		}
+		var out bytes.Buffer
+		if err := StreamCommand(CommandIO{Stdin: strings.NewReader(registryHost(reg.Registry)), Stdout: &out}, helper, "get"); err != nil {
+			return "", "", time.Time{}, toolError(err, "error getting the credentials of registry '%s' from docker-credential-%s", reg.Name, reg.Helper)
+		}
+		var creds struct {
+			Username string `json:"Username"`
+			Secret   string `json:"Secret"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &creds); err != nil || creds.Secret == "" {
+			return "", "", time.Time{}, toolError(err, "docker-credential-%s returned no credentials for registry '%s'", reg.Helper, reg.Name)
+		}
+		return creds.Username, creds.Secret, time.Time{}, nil
+	}
+	return reg.Username, reg.Password, time.Time{}, nil
+}
+
+// registryAuth is the username and password a registry was logged into with.
+type registryAuth struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// loginRegistry logs Docker into a registry, records the login and returns the
+// credentials used. The password is passed on stdin so that it never appears in the
+// process list or goes through a shell.
+func loginRegistry(reg RegistryConfig) (registryAuth, error) {
+	now := time.Now()
+	username, password, expiresAt, err := registryCredentials(reg, now)
+	if err != nil {
+		return registryAuth{}, err
+	}
+	fmt.Printf("Logging into registry %s (%s)...\n", reg.Name, reg.Registry)
+	input := CommandIO{Stdin: strings.NewReader(password)}
+	if err := StreamCommand(input, "docker", "login", "--username", username, "--password-stdin", reg.Registry); err != nil {
+		return registryAuth{}, toolError(err, "error logging into registry '%s'", reg.Name)
+	}
+	if err := recordRegistryLogin(reg.Registry, registryLogin{LoggedInAt: now, ExpiresAt: expiresAt}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record the login to registry %s: %s\n", reg.Name, err)
+	}
+	if !expiresAt.IsZero() {
+		fmt.Printf("The token of registry %s expires at %s; up and install log in again when needed\n", reg.Name, expiresAt.Format("2006-01-02 15:04"))
+	}
+	return registryAuth{Registry: registryHost(reg.Registry), Username: username, Password: password}, nil
+}
+
+// registryLogin records a successful login to a registry.
+type registryLogin struct {
+	LoggedInAt time.Time `json:"logged_in_at"`
+	// ExpiresAt is zero for credentials that don't expire.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// expiresSoon reports whether the login has expired or is about to.
+func (l registryLogin) expiresSoon(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && now.Add(registryLoginMargin).After(l.ExpiresAt)
+}
+
+func registryLoginsPath() (string, error) {
+	home, err := upctlHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "state", registryLoginsFile), nil
+}
+
+// readRegistryLogins returns the recorded registry logins by registry hostname.
+func readRegistryLogins() (map[string]registryLogin, error) {
+	logins := make(map[string]registryLogin)
+	path, err := registryLoginsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return logins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &logins); err != nil {
+		return nil, fmt.Errorf("error reading registry logins '%s': %w", path, err)
+	}
+	return logins, nil
+}
+
+// recordRegistryLogin stores a login to registry in the upctl state.
+func recordRegistryLogin(registry string, login registryLogin) error {
+	logins, err := readRegistryLogins()
+	if err != nil {
+		logins = make(map[string]registryLogin)
+	}
+	logins[registryHost(registry)] = login
+	data, err := json.MarshalIndent(logins, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := registryLoginsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	_, err = writeFileIfChanged(path, data, 0600)
+	return err
+}
+
+// imageRegistry returns the registry hostname of an image reference, or "" for
+// images from Docker Hub.
+func imageRegistry(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if !found || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return ""
+	}
+	return first
+}
+
+// ensureRegistryLogin logs into the registries with expiring logins, such as ECR
+// tokens, again when some of services pull images from them and the recorded login
+// is missing or about to expire. Without services every service counts.
+func ensureRegistryLogin(services []string) error {
+	registries, err := loadRegistries(dockerConfig)
+	if err != nil || len(registries) == 0 {
+		return err
+	}
+	if len(services) == 0 {
+		for name := range dockerComposeConfig.Services {
+			services = append(services, name)
+		}
+	}
+	used := make(map[string]bool)
+	for _, name := range services {
+		used[imageRegistry(dockerComposeConfig.Services[name].Image)] = true
+	}
+
+	logins, err := readRegistryLogins()
+	if err != nil {
+		return err
+	}
+	for _, reg := range registries {
+		host := registryHost(reg.Registry)
+		if !reg.expires() || !used[host] {
+			continue
+		}
+		if login, ok := logins[host]; ok && !login.expiresSoon(time.Now()) {
+			continue
+		}
+		fmt.Printf("Credentials for registry %s are missing or expired; logging in again...\n", reg.Name)
+		if _, err := loginRegistry(reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
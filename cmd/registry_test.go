@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestEcrRegion(t *testing.T) {
+	originalTeleport := teleportConfig
+	defer func() { teleportConfig = originalTeleport }()
+
+	tests := []struct {
+		name           string
+		reg            RegistryConfig
+		teleportRegion string
+		want           string
+		wantErr        bool
+	}{
+		{name: "configured region wins", reg: RegistryConfig{Region: "us-east-2", Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com"}, want: "us-east-2"},
+		{name: "region from ECR hostname", reg: RegistryConfig{Registry: "123456789012.dkr.ecr.ap-southeast-2.amazonaws.com"}, teleportRegion: "eu-west-1", want: "ap-southeast-2"},
+		{name: "hostname with scheme and path", reg: RegistryConfig{Registry: "https://123456789012.dkr.ecr.eu-central-1.amazonaws.com/team"}, want: "eu-central-1"},
+		{name: "teleport region as fallback", reg: RegistryConfig{Registry: "registry.example.com"}, teleportRegion: "eu-west-2", want: "eu-west-2"},
+		{name: "no region anywhere", reg: RegistryConfig{Registry: "registry.example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teleportConfig = TeleportConfig{AWSRegion: tt.teleportRegion}
+			got, err := ecrRegion(tt.reg)
+			if tt.wantErr {
+				if ExitCode(err) != ExitConfig {
+					t.Errorf("Expected a config error, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ecrRegion() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	for image, want := range map[string]string{
+		"mysql:8.0":              "",
+		"grafana/grafana:latest": "",
+		"ghcr.io/org/app:1.0":    "ghcr.io",
+		"localhost/app":          "localhost",
+		"localhost:5000/app":     "localhost:5000",
+		"123.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:abc": "123.dkr.ecr.eu-west-1.amazonaws.com",
+	} {
+		if got := imageRegistry(image); got != want {
+			t.Errorf("imageRegistry(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestEnsureRegistryLogin(t *testing.T) {
+	setup(t)
+	defer teardown()
+	fakeTools(t, "tsh")
+	recordAllCommands(t)
+	const registry = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	originalDocker, originalCompose := dockerConfig, dockerComposeConfig
+	defer func() { dockerConfig, dockerComposeConfig = originalDocker, originalCompose }()
+	dockerConfig = DockerConfig{Registry: registry, UseTeleport: true, AWSApp: "ecr"}
+	originalTeleport := teleportConfig
+	defer func() { teleportConfig = originalTeleport }()
+	teleportConfig = TeleportConfig{Host: "teleport.example.com", AWSRole: "dev"}
+	mockTeleport(t, "teleport.example.com", time.Now().Add(8*time.Hour), map[string]string{"ecr": writeTestCert(t, time.Now().Add(time.Hour))})
+	viper.Set("services", map[string]interface{}{
+		"api":   map[string]interface{}{"image": registry + "/api:latest"},
+		"mysql": map[string]interface{}{"image": "mysql:8.0"},
+	})
+	cfg, err := loadComposeConfig()
+	if err != nil {
+		t.Fatalf("loadComposeConfig() returned an error: %v", err)
+	}
+	dockerComposeConfig = cfg
+
+	loggedIn := func() bool {
+		defer func() { mockExecuteTracker = nil }()
+		for _, call := range mockExecuteTracker {
+			if call.Command == "docker" && len(call.Args) > 0 && call.Args[0] == "login" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := ensureRegistryLogin([]string{"mysql"}); err != nil || loggedIn() {
+		t.Errorf("Expected no login for services not using the registry, got %v", err)
+	}
+	if err := ensureRegistryLogin([]string{"api"}); err != nil || !loggedIn() {
+		t.Fatalf("Expected a login when none is recorded, got %v", err)
+	}
+	logins, _ := readRegistryLogins()
+	login, ok := logins[registry]
+	if !ok || login.ExpiresAt.Sub(login.LoggedInAt) != ecrTokenLifetime {
+		t.Errorf("Expected a login expiring after %s to be recorded, got %+v", ecrTokenLifetime, logins)
+	}
+	if err := ensureRegistryLogin([]string{"api"}); err != nil || loggedIn() {
+		t.Errorf("Expected a valid login to be reused, got %v", err)
+	}
+
+	recordRegistryLogin(registry, registryLogin{LoggedInAt: time.Now().Add(-12 * time.Hour), ExpiresAt: time.Now().Add(5 * time.Minute)})
+	if err := ensureRegistryLogin(nil); err != nil {
+		t.Fatalf("ensureRegistryLogin() returned an error: %v", err)
+	}
+	var regionArgs string
+	for _, call := range mockExecuteTracker {
+		if strings.Contains(strings.Join(call.Args, " "), "get-login-password") {
+			regionArgs = strings.Join(call.Args, " ")
+		}
+	}
+	if !loggedIn() {
+		t.Errorf("Expected a login about to expire to be renewed")
+	}
+	if !strings.HasSuffix(regionArgs, "--region eu-west-1") {
+		t.Errorf("Expected the region from the registry hostname, got %q", regionArgs)
+	}
+}
+
+func TestLoadRegistries(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DockerConfig
+		wantErr string
+	}{
+		{name: "legacy single registry", cfg: DockerConfig{Registry: "registry.example.com", UseTeleport: true, AWSApp: "ecr"}},
+		{name: "nothing configured", cfg: DockerConfig{}},
+		{name: "unknown auth", cfg: DockerConfig{Registries: []RegistryConfig{{Name: "a", Registry: "a.io", Auth: "kerberos"}}}, wantErr: "unsupported auth 'kerberos'"},
+		{name: "env without variable", cfg: DockerConfig{Registries: []RegistryConfig{{Name: "ghcr", Registry: "ghcr.io", Auth: authEnv, Username: "me"}}}, wantErr: "needs 'password_env'"},
+		{name: "helper without helper", cfg: DockerConfig{Registries: []RegistryConfig{{Name: "a", Registry: "a.io", Auth: authHelper}}}, wantErr: "needs 'helper'"},
+		{name: "duplicate names", cfg: DockerConfig{Registries: []RegistryConfig{{Name: "a", Registry: "a.io"}, {Name: "a", Registry: "b.io"}}}, wantErr: "more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registries, err := loadRegistries(tt.cfg)
+			if tt.wantErr != "" {
+				if ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected a config error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadRegistries() returned an error: %v", err)
+			}
+			if tt.cfg.Registry != "" && (len(registries) != 1 || registries[0].Auth != authTeleportECR || registries[0].Username != "AWS") {
+				t.Errorf("Unexpected legacy registry %+v", registries)
+			}
+		})
+	}
+}
+
+func TestConfigDocker_Registries(t *testing.T) {
+	setup(t)
+	defer teardown()
+	fakeTools(t, "docker-credential-pass")
+	recordAllCommands(t)
+	StreamCommand = func(input CommandIO, command string, args ...string) error {
+		if strings.HasSuffix(command, "docker-credential-pass") {
+			_, err := io.WriteString(input.Stdout, `{"ServerURL": "registry.internal", "Username": "robot", "Secret": "helper-secret"}`)
+			return err
+		}
+		return mockStreamCommand(input, command, args...)
+	}
+	t.Setenv("GHCR_TOKEN", "ghcr-secret")
+	originalDocker := dockerConfig
+	defer func() { dockerConfig = originalDocker }()
+	dockerConfig = DockerConfig{Registries: []RegistryConfig{
+		{Name: "ecr", Registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", Auth: authAWSECR, Profile: "dev"},
+		{Name: "ghcr", Registry: "ghcr.io", Auth: authEnv, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+		{Name: "internal", Registry: "registry.internal", Auth: authHelper, Helper: "pass"},
+		{Name: "hub", Registry: "docker.io", Username: "me", Password: "hub-secret"},
+	}}
+
+	logins := func() map[string]string {
+		result := make(map[string]string)
+		for _, call := range mockExecuteTracker {
+			if call.Command == "docker" && call.Args[0] == "login" {
+				result[call.Args[len(call.Args)-1]] = call.Args[2] + ":" + call.Stdin
+			}
+		}
+		mockExecuteTracker = nil
+		return result
+	}
+
+	if err := configDocker("ghcr"); err != nil {
+		t.Fatalf("configDocker(ghcr) returned an error: %v", err)
+	}
+	if got := logins(); len(got) != 1 || got["ghcr.io"] != "me:ghcr-secret" {
+		t.Errorf("Expected only ghcr.io to be logged into with the token from GHCR_TOKEN, got %v", got)
+	}
+
+	if err := configDocker(); err != nil {
+		t.Fatalf("configDocker() returned an error: %v", err)
+	}
+	if ecr := mockExecuteTracker[0]; ecr.Command != "aws" || strings.Join(ecr.Args, " ") != "ecr get-login-password --region us-east-1 --profile dev" {
+		t.Errorf("Expected the ECR password from the aws CLI, got %s %v", ecr.Command, ecr.Args)
+	}
+	want := map[string]string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com": "AWS:container-id",
+		"ghcr.io":           "me:ghcr-secret",
+		"registry.internal": "robot:helper-secret",
+		"docker.io":         "me:hub-secret",
+	}
+	got := logins()
+	for registry, credentials := range want {
+		if got[registry] != credentials {
+			t.Errorf("Expected a login to %s as %q, got %q", registry, credentials, got[registry])
+		}
+	}
+
+	if err := configDocker("ghcr", "quay"); ExitCode(err) != ExitServiceNotFound || !strings.Contains(err.Error(), "quay") {
+		t.Errorf("Expected a not found error for quay, got %v", err)
+	}
+}
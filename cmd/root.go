@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -15,19 +16,20 @@ import (
 
 // DockerComposeConfigForDoctor is a simplified struct for doctor command's needs.
 type DockerComposeConfigForDoctor struct {
-	Services map[string]interface{} `mapstructure:"services"`
-	Volumes  map[string]interface{} `mapstructure:"volumes"`  // Kept for structural integrity if present
-	Networks map[string]interface{} `mapstructure:"networks"` // Kept for structural integrity if present
+	Services map[string]ComposeService `mapstructure:"-"`
+	Volumes  map[string]interface{}    `mapstructure:"volumes"`  // Kept for structural integrity if present
+	Networks map[string]interface{}    `mapstructure:"networks"` // Kept for structural integrity if present
 }
 
 // UpctlConfigForValidation defines the expected structure of upctl.yaml for validation.
 type UpctlConfigForValidation struct {
-	Services       map[string]interface{} `mapstructure:"services"`
-	Volumes        map[string]interface{} `mapstructure:"volumes"`
-	Networks       map[string]interface{} `mapstructure:"networks"`
-	MySQLConfig    MySQLConfig            `mapstructure:"mysql"`
-	TeleportConfig TeleportConfig         `mapstructure:"teleport"`
-	DockerConfig   DockerConfig           `mapstructure:"docker_config"`
+	Services       map[string]ComposeService `mapstructure:"-"`
+	Groups         map[string][]string       `mapstructure:"groups"`
+	Volumes        map[string]interface{}    `mapstructure:"volumes"`
+	Networks       map[string]interface{}    `mapstructure:"networks"`
+	MySQLConfig    MySQLConfig               `mapstructure:"mysql"`
+	TeleportConfig TeleportConfig            `mapstructure:"teleport"`
+	DockerConfig   DockerConfig              `mapstructure:"docker_config"`
 }
 
 // MySQLConfig is the struct that holds the config values
@@ -41,6 +43,8 @@ type MySQLConfig struct {
 	S3Bucket string `mapstructure:"s3_bucket"`
 	S3Key    string `mapstructure:"s3_key"`
 	S3Region string `mapstructure:"s3_region"`
+
+	PostImport []PostImportHook `mapstructure:"post_import"`
 }
 
 // TeleportConfig is the struct that holds the Teleport config values
@@ -60,6 +64,11 @@ type DockerConfig struct {
 	Password    string   `mapstructure:"password"`
 	UseTeleport bool     `mapstructure:"use_teleport"`
 	AWSApp      string   `mapstructure:"aws_app"`
+	Region      string   `mapstructure:"region"`
+
+	// Registries lists several registries to log into; without it the fields above
+	// describe a single one.
+	Registries []RegistryConfig `mapstructure:"registries"`
 }
 
 var (
@@ -70,12 +79,15 @@ var (
 		Use:   "upctl",
 		Short: "upctl is a CLI tool to manage UpTimeLabs local development environment",
 		Long:  `upctl is a CLI tool to manage UpTimeLabs local development environment`,
+
+		// Errors are printed once by Execute; usage is only useful for argument mistakes.
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
 	mysqlConfig    MySQLConfig
 	teleportConfig TeleportConfig
 	dockerConfig   DockerConfig
-	teleportHost   string
 
 	progress *spinner.Spinner
 
@@ -85,53 +97,93 @@ var (
 
 	// Flag to skip config reloading during tests
 	skipConfigReload bool
+
+	// configLoadErr is the error from loading upctl.yaml in initConfig, if any.
+	configLoadErr error
 )
 
-// Execute executes the root command.
+// Execute executes the root command. The returned error can be passed to ExitCode.
 func Execute() error {
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+	StopProgress()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if ExitCode(err) == ExitUsage {
+			fmt.Fprintln(os.Stderr, "Run 'upctl --help' for usage.")
+		}
+	}
+	return err
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
-
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.upctl.yaml)")
+	rootCmd.PersistentPreRunE = checkConfigLoaded
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &Error{Kind: KindUsage, Err: err}
+	})
+
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "project config file, merged over $HOME/.upctl.yaml (default is ./upctl.yaml or ./.upctl.yaml)")
+	rootCmd.PersistentFlags().String("backend", "", "backend used to install packages: compose or helm (default from config, else compose)")
+	viper.BindPFlag("backend", rootCmd.PersistentFlags().Lookup("backend"))
+	rootCmd.PersistentFlags().String("runtime", "", "container runtime: docker, podman, podman-compose or nerdctl (default from config, else docker)")
+	viper.BindPFlag("runtime", rootCmd.PersistentFlags().Lookup("runtime"))
 	viper.BindPFlag("author", rootCmd.PersistentFlags().Lookup("author"))
 	viper.SetDefault("author", "Gamunu Balagalla <gamunu@upltimelabs.io>")
 	viper.SetDefault("license", "(C) UpTimeLabs")
 
 	installCmd = &cobra.Command{
-		Use:   "install [service]",
-		Short: "Install and start a specific service using Docker Compose",
-		Long:  `Install and start a specific service from the configuration using Docker Compose.`,
-		Args:  cobra.MaximumNArgs(1),
-		Run: func(ccmd *cobra.Command, args []string) {
+		Use:   "install [service...]",
+		Short: "Install and start services using Docker Compose or Helm",
+		Long:  `Install and start one or more services or @groups from the configuration using Docker Compose, together with the services they depend on. With the helm backend the arguments name packages from the 'packages' section and are installed as Helm releases.`,
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(ccmd *cobra.Command, args []string) error {
+			if all, _ := ccmd.Flags().GetBool("all"); all && len(args) > 0 {
+				return usageError("cannot specify service names when the --all flag is used for 'install'")
+			}
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 			}
-			RunDockerComposeInstall(ccmd, args)
+			switch backend := activeBackend(); backend {
+			case backendHelm:
+				return RunHelmInstall(ccmd, args)
+			case backendCompose:
+				return RunDockerComposeInstall(ccmd, args)
+			default:
+				return configError(nil, "unknown backend '%s', expected '%s' or '%s'", backend, backendCompose, backendHelm)
+			}
 		},
 	}
 	installCmd.Flags().BoolP("all", "a", false, "Install all services")
+	addWaitFlags(installCmd)
 	// Add --all flag to upCmd
 	upCmd.Flags().BoolP("all", "a", false, "Start all services")
+	addWaitFlags(upCmd)
 	// Add --all flag to downCmd
 	downCmd.Flags().BoolP("all", "a", false, "Stop all services")
+	downCmd.Flags().Bool("cascade", false, "Also stop the services that depend on the given services")
+	downCmd.Flags().Bool("volumes", false, "Remove the project's volumes too (only with --all)")
 	// Add --all flag to logsCmd
 	logsCmd.Flags().BoolP("all", "a", false, "Get logs for all services")
+	// Output selection for psCmd
+	psCmd.Flags().StringP("output", "o", psOutputTable, "Output format: table, wide, json or yaml")
+	psCmd.Flags().String("format", "", "Format each service with a Go template, e.g. '{{.Service}} {{.State}}'")
 
 	importDBCmd = &cobra.Command{
-		Use:   "import-db",
-		Short: "Import a database into a Docker MySQL container",
-		Long:  `Import a database into the MySQL service defined in Docker Compose.`,
-		Run: func(ccmd *cobra.Command, args []string) {
+		Use:   "import-db [database...]",
+		Short: "Import databases into their Docker Compose containers",
+		Long:  `Imports the dumps of the named databases from the 'databases' section of upctl.yaml, or of all of them with --all. Without a 'databases' section the 'mysql' section is imported into the mysql service. Databases in different containers are imported in parallel.`,
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(ccmd *cobra.Command, args []string) error {
 			if progress == nil {
 				progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 			}
-			RunDockerImportDB(ccmd, args)
+			return RunDockerImportDB(ccmd, args)
 		},
 	}
 
+	importDBCmd.Flags().BoolP("all", "a", false, "Import all databases")
+	importDBCmd.Flags().Bool("refresh", false, "Download the dumps again even if the cached ones are up to date")
+
 	rootCmd.AddCommand(
 		upCmd,       // Renamed from startCmd
 		downCmd,     // New
@@ -144,6 +196,13 @@ func init() {
 		validateCmd, // Existing
 		versionCmd,  // Existing
 		volumesCmd,  // New
+		removeCmd,   // Helm backend
+		upgradeCmd,  // Helm backend
+		dbCmd,       // Database dumps and snapshots
+		cacheCmd,    // Cache of downloaded dumps
+		loginCmd,    // Teleport session
+		logoutCmd,   // Teleport session
+		whoamiCmd,   // Teleport session
 	)
 }
 
@@ -151,76 +210,83 @@ var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate the upctl.yaml configuration file",
 	Long:  `Checks the syntax and structure of the upctl.yaml file.`,
-	Run: func(ccmd *cobra.Command, args []string) {
+	RunE: func(ccmd *cobra.Command, args []string) error {
 		// The global cfgFile is populated by Cobra from the --config flag
-		runValidationChecks(ccmd, args, cfgFile)
+		return runValidationChecks(ccmd, args, cfgFile)
 	},
 }
 
-func runValidationChecks(cmd *cobra.Command, args []string, explicitPath string) {
-	fmt.Println("Validating upctl.yaml...")
-	viper.SetConfigType("yaml") // Set type universally
-
-	if explicitPath != "" {
-		viper.SetConfigFile(explicitPath)
-	} else {
-		home, _ := os.UserHomeDir()
-		if home != "" {
-			viper.AddConfigPath(home)
-		}
-		viper.AddConfigPath(".")
-		viper.SetConfigName(".upctl")
-	}
+// errConfigInvalid is returned by validate and doctor after they have printed the details.
+var errConfigInvalid = configError(nil, "configuration is invalid")
 
-	if err := viper.ReadInConfig(); err != nil {
-		filePathTried := cfgFile // Path explicitly attempted if --config was used
-		if filePathTried == "" { // If --config was not used, Viper searched default paths
-			filePathTried = "default paths ($HOME/.upctl.yaml, ./.upctl.yaml)"
+func runValidationChecks(cmd *cobra.Command, args []string, explicitPath string) error {
+	fmt.Println("Validating upctl.yaml...")
+	if err := readConfig(explicitPath); err != nil {
+		filePathTried := explicitPath // Path explicitly attempted if --config was used
+		if filePathTried == "" {      // If --config was not used, the layers were searched
+			filePathTried = "default paths ($HOME/.upctl.yaml, ./upctl.yaml, ./.upctl.yaml)"
 		}
 		// Provide a comprehensive error message
-		fmt.Printf("Error: Failed to load or parse configuration. Attempted: %s. Viper error: %v\n", filePathTried, err)
-		return
+		fmt.Printf("Error: Failed to load or parse configuration. Attempted: %s. Error: %v\n", filePathTried, err)
+		return errConfigInvalid
 	}
 
-	// If ReadInConfig is successful:
-	fmt.Println("Successfully read configuration file:", viper.ConfigFileUsed())
+	fmt.Println("Successfully read configuration file:", strings.Join(configFiles, ", "))
 	fmt.Println("YAML syntax: OK")
 
 	// Structure Validation
 	var cfg UpctlConfigForValidation
-	if err := viper.Unmarshal(&cfg); err != nil {
+	err := viper.Unmarshal(&cfg)
+	if err == nil {
+		cfg.Services, err = decodeComposeServices(servicesConfig())
+	}
+	if err != nil {
 		fmt.Printf("Error: Configuration file structure is invalid. Ensure top-level keys and their types are correct. Details: %v\n", err)
-		return
+		return errConfigInvalid
 	}
 	fmt.Println("Overall structure: OK")
 
 	// Specific check for 'services'
 	if cfg.Services == nil {
 		fmt.Println("Error: The 'services' key is missing or empty in upctl.yaml. This is a required field.")
-		return
+		return errConfigInvalid
 	}
 	fmt.Println("'services' key: Present and structurally valid (according to unmarshal).")
 
+	if err := validateServiceGroups(cfg.Groups, cfg.Services); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return errConfigInvalid
+	}
+	if len(cfg.Groups) > 0 {
+		fmt.Println("'groups' key: OK")
+	}
+
+	if _, err := loadRegistries(cfg.DockerConfig); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return errConfigInvalid
+	}
+
 	// Potentially check other required sections if any, e.g. mysql, teleport, docker_config
 	// For now, just checking their structural validity via Unmarshal.
 
 	fmt.Println("upctl.yaml is valid.")
+	return nil
 }
 
 var doctorCmd = &cobra.Command{
 	Use:   "doctor",
 	Short: "Check for potential issues with upctl setup and configuration",
 	Long:  `Diagnoses potential problems like missing or invalid configuration, and port conflicts.`,
-	Run:   runDoctorChecks,
+	RunE:  runDoctorChecks,
 }
 
-func runDoctorChecks(cmd *cobra.Command, args []string) {
+func runDoctorChecks(cmd *cobra.Command, args []string) error {
 	fmt.Println("--- Upctl Doctor ---")
 
 	// Check 1: Config file existence and loading
 	fmt.Print("1. Checking config file... ")
 	if viper.ConfigFileUsed() == "" {
-		fmt.Println("Error: Config file not found. Please ensure .upctl.yaml exists in your home directory or current directory.")
+		fmt.Println("Error: Config file not found. Please ensure upctl.yaml exists in the current directory or .upctl.yaml in your home directory.")
 		// Attempt to read anyway, viper might find it if SetConfigName was used, though initConfig should handle this.
 		// For doctor, we rely on initConfig having run.
 	} else {
@@ -229,23 +295,27 @@ func runDoctorChecks(cmd *cobra.Command, args []string) {
 
 	// This check might be redundant if initConfig already exited on error.
 	// However, doctor can be an independent check.
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			fmt.Println("   Error: Config file not found by Viper. Expected $HOME/.upctl.yaml or ./.upctl.yaml.")
+	if err := readConfig(viper.ConfigFileUsed()); err != nil {
+		if errors.Is(err, errNoConfigFile) {
+			fmt.Println("   Error: Config file not found. Expected $HOME/.upctl.yaml, ./upctl.yaml or ./.upctl.yaml.")
 		} else {
 			fmt.Printf("   Error: Could not read config file: %v. YAML might be invalid.\n", err)
 		}
 		// Don't return yet, try to proceed with other checks if possible, or make a decision to stop.
 		// For port checks, we need the config, so we'll stop here if it's unreadable.
-		return
+		return errConfigInvalid
 	}
 
 	// Check 2: Validate upctl.yaml structure
 	fmt.Print("2. Validating config structure (services, volumes, networks)... ")
 	var cfg DockerComposeConfigForDoctor
-	if err := viper.Unmarshal(&cfg); err != nil {
+	err := viper.Unmarshal(&cfg)
+	if err == nil {
+		cfg.Services, err = decodeComposeServices(servicesConfig())
+	}
+	if err != nil {
 		fmt.Printf("Error: Could not parse upctl.yaml structure: %v\n", err)
-		return // Can't proceed with port checks if structure is wrong
+		return errConfigInvalid // Can't proceed with port checks if structure is wrong
 	}
 	fmt.Println("OK")
 
@@ -253,7 +323,7 @@ func runDoctorChecks(cmd *cobra.Command, args []string) {
 	fmt.Print("3. Checking for 'services' definition... ")
 	if cfg.Services == nil {
 		fmt.Println("Error: 'services' key not found or empty in upctl.yaml. Cannot check for port conflicts.")
-		return
+		return errConfigInvalid
 	}
 	if len(cfg.Services) == 0 {
 		fmt.Println("Info: No services defined under 'services' key in upctl.yaml.")
@@ -270,50 +340,17 @@ func runDoctorChecks(cmd *cobra.Command, args []string) {
 		portToServicesMap := make(map[string][]string)     // Stores listenAddress -> serviceNames
 		listenAddressToHostPort := make(map[string]string) // Stores listenAddress -> hostPort (for cleaner reporting)
 
-		for serviceName, serviceData := range cfg.Services {
-			serviceMap, ok := serviceData.(map[string]interface{})
-			if !ok {
-				fmt.Printf("   Warning: Could not parse service definition for '%s'. Skipping port check.\n", serviceName)
-				continue
-			}
-
-			portsInterface, exists := serviceMap["ports"]
-			if !exists {
-				// fmt.Printf("   Info: No ports defined for service '%s'.\n", serviceName)
-				continue // No ports defined for this service
-			}
-
-			portsList, ok := portsInterface.([]interface{})
-			if !ok {
-				fmt.Printf("   Warning: 'ports' for service '%s' is not a list. Skipping port check.\n", serviceName)
-				continue
-			}
-
-			for _, portEntryInterface := range portsList {
-				portEntry, ok := portEntryInterface.(string)
-				if !ok {
-					fmt.Printf("   Warning: Invalid port entry (not a string) for service '%s'. Skipping.\n", serviceName)
-					continue
-				}
-
-				parts := strings.Split(portEntry, ":")
-				var hostPortStr string
-				var hostIP string
-
-				if len(parts) == 1 {
-					hostPortStr = parts[0]
-				} else if len(parts) == 2 {
-					hostPortStr = parts[0]
-				} else if len(parts) == 3 {
-					hostIP = parts[0]
-					hostPortStr = parts[1]
-				} else {
-					fmt.Printf("     Warning: Invalid port format '%s' for service '%s'. Skipping.\n", portEntry, serviceName)
-					continue
+		for serviceName, service := range cfg.Services {
+			for _, port := range service.Ports {
+				hostIP := port.HostIP
+				hostPortStr := port.Published
+				if hostPortStr == "" {
+					// Only the container port is given; check it as the host port too.
+					hostPortStr = port.Target
 				}
 
 				if _, err := strconv.Atoi(hostPortStr); err != nil {
-					fmt.Printf("     Warning: Host port part '%s' (from entry '%s' for service '%s') is not a valid number. Skipping.\n", hostPortStr, portEntry, serviceName)
+					fmt.Printf("     Warning: Host port part '%s' (for service '%s') is not a valid number. Skipping.\n", hostPortStr, serviceName)
 					continue
 				}
 
@@ -375,13 +412,14 @@ func runDoctorChecks(cmd *cobra.Command, args []string) {
 		fmt.Println("  Info: No services defined to check for port conflicts.")
 	}
 	fmt.Println("\n--- Doctor checks complete ---")
+	return nil
 }
 
 // upCmd represents the up command (renamed from startCmd)
 var upCmd = &cobra.Command{
-	Use:   "up [service]",
+	Use:   "up [service...]",
 	Short: "Start specified or all services using Docker Compose",
-	Long:  `Starts the services defined in your upctl.yaml file using Docker Compose. Equivalent to 'docker compose up -d'. You can optionally specify a single service to start, or use the --all flag to start all services.`,
+	Long:  `Starts the services defined in your upctl.yaml file using Docker Compose. Equivalent to 'docker compose up -d'. You can specify one or more services or @groups to start, or use the --all flag to start all services. Services the selected ones depend on are started too. With --wait, upctl waits until the containers are running and healthy and fails with their last log lines if one exits, restarts or becomes unhealthy.`,
 	Args:  cobra.ArbitraryArgs, // Changed to ArbitraryArgs for manual validation
 	RunE: func(ccmd *cobra.Command, args []string) error { // Changed to RunE
 		allServices, _ := ccmd.Flags().GetBool("all")
@@ -389,29 +427,25 @@ var upCmd = &cobra.Command{
 
 		if allServices {
 			if numArgs > 0 {
-				return fmt.Errorf("cannot specify service names when the --all flag is used")
+				return usageError("cannot specify service names when the --all flag is used")
 			}
 		} else {
 			if numArgs == 0 {
-				return fmt.Errorf("you must specify a service name or use the --all flag")
-			}
-			if numArgs > 1 {
-				return fmt.Errorf("too many arguments, expected 1 service name or --all flag (got %d)", numArgs)
+				return usageError("you must specify a service name or use the --all flag")
 			}
 		}
 
 		if progress == nil {
 			progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 		}
-		RunDockerComposeUp(ccmd, args)
-		return nil // Return nil on success
+		return RunDockerComposeUp(ccmd, args) // Return nil on success
 	},
 }
 
 var downCmd = &cobra.Command{
-	Use:   "down [service]",
+	Use:   "down [service...]",
 	Short: "Stop Docker Compose services",
-	Long:  `Stops and removes containers, networks, volumes, and images created by 'up'. Equivalent to 'docker compose down'. You can optionally specify a single service to stop, or use --all to stop all services.`,
+	Long:  `Stops and removes the containers of the given services or @groups, leaving the rest of the project running. With --cascade the services that depend on them are stopped too. Use --all to tear down the whole project like 'docker compose down'; add --volumes to remove its volumes as well.`,
 	Args:  cobra.ArbitraryArgs,
 	RunE: func(ccmd *cobra.Command, args []string) error {
 		allServices, _ := ccmd.Flags().GetBool("all")
@@ -419,29 +453,25 @@ var downCmd = &cobra.Command{
 
 		if allServices {
 			if numArgs > 0 {
-				return fmt.Errorf("cannot specify service names when the --all flag is used for 'down'")
+				return usageError("cannot specify service names when the --all flag is used for 'down'")
 			}
 		} else {
 			if numArgs == 0 {
-				return fmt.Errorf("you must specify a service name or use the --all flag for 'down'")
-			}
-			if numArgs > 1 {
-				return fmt.Errorf("too many arguments to 'down', expected 1 service name or --all flag (got %d)", numArgs)
+				return usageError("you must specify a service name or use the --all flag for 'down'")
 			}
 		}
 
 		if progress == nil {
 			progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 		}
-		RunDockerComposeDown(ccmd, args)
-		return nil
+		return RunDockerComposeDown(ccmd, args)
 	},
 }
 
 var logsCmd = &cobra.Command{
-	Use:   "logs [service]",
+	Use:   "logs [service...]",
 	Short: "Show logs for services",
-	Long:  `Displays log output from services. Equivalent to 'docker compose logs --follow'. Optionally specify a service name, or use --all to view logs for all services.`,
+	Long:  `Displays log output from services. Equivalent to 'docker compose logs --follow'. Specify one or more service names or @groups, or use --all to view logs for all services.`,
 	Args:  cobra.ArbitraryArgs,
 	RunE: func(ccmd *cobra.Command, args []string) error {
 		allServices, _ := ccmd.Flags().GetBool("all")
@@ -449,22 +479,18 @@ var logsCmd = &cobra.Command{
 
 		if allServices {
 			if numArgs > 0 {
-				return fmt.Errorf("cannot specify service names when the --all flag is used for 'logs'")
+				return usageError("cannot specify service names when the --all flag is used for 'logs'")
 			}
 		} else {
 			if numArgs == 0 {
-				return fmt.Errorf("you must specify a service name or use the --all flag for 'logs'")
-			}
-			if numArgs > 1 {
-				return fmt.Errorf("too many arguments to 'logs', expected 1 service name or --all flag (got %d)", numArgs)
+				return usageError("you must specify a service name or use the --all flag for 'logs'")
 			}
 		}
 
 		if progress == nil {
 			progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 		}
-		RunDockerComposeLogs(ccmd, args)
-		return nil
+		return RunDockerComposeLogs(ccmd, args)
 	},
 }
 
@@ -472,13 +498,13 @@ var logsCmd = &cobra.Command{
 var psCmd = &cobra.Command{
 	Use:   "ps [service...]",
 	Short: "List running services and all available services from config",
-	Long:  `Displays a list of all services defined in the upctl.yaml configuration file, along with their current running status (similar to 'docker compose ps'). If one or more service names are provided as arguments, the output will be filtered to show only those services.`,
+	Long:  `Displays a list of all services defined in the upctl.yaml configuration file, along with their current running status (similar to 'docker compose ps'). If one or more service names or @groups are provided as arguments, the output will be filtered to show only those services. Use --output json, yaml or wide for untruncated output, or --format with a Go template.`,
 	Args:  cobra.ArbitraryArgs, // Allows for optional service names
-	Run: func(ccmd *cobra.Command, args []string) {
+	RunE: func(ccmd *cobra.Command, args []string) error {
 		if progress == nil {
 			progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 		}
-		RunDockerComposePs(ccmd, args) // args will be passed to RunDockerComposePs for potential filtering
+		return RunDockerComposePs(ccmd, args) // args will be passed to RunDockerComposePs for potential filtering
 	},
 }
 
@@ -492,52 +518,53 @@ func initConfig() {
 		return
 	}
 
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".upctl" (without extension).
-		viper.AddConfigPath(home)
-		viper.AddConfigPath(".") // optionally look for config in the working directory
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".upctl")
-	}
+	// Set the global progress spinner
+	progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
-	} else {
-		fmt.Println("Error reading config file:", err.Error())
-		os.Exit(1)
+	// cobra.OnInitialize can't fail a command, so the error is returned from rootCmd's PersistentPreRunE.
+	configLoadErr = loadConfig()
+}
+
+// loadConfig reads upctl.yaml and the sections that are kept in package level variables.
+func loadConfig() error {
+	if err := readConfig(cfgFile); err != nil {
+		return configError(err, "error reading config file")
 	}
+	// Stderr, so that machine-readable output such as 'ps -o json' stays parseable.
+	fmt.Fprintln(os.Stderr, "Using config file:", strings.Join(configFiles, ", "))
 
 	// Set Viper values to local variables
-	err := viper.UnmarshalKey("teleport", &teleportConfig)
-	if err != nil {
-		fmt.Printf("Error unmarshaling teleport: %s", err.Error())
-		os.Exit(1)
+	if err := viper.UnmarshalKey("teleport", &teleportConfig); err != nil {
+		return configError(err, "error unmarshaling teleport")
 	}
 
-	err = viper.UnmarshalKey("mysql", &mysqlConfig)
-	if err != nil {
-		fmt.Printf("Error unmarshaling mysql: %s", err.Error())
-		os.Exit(1)
+	if err := viper.UnmarshalKey("mysql", &mysqlConfig); err != nil {
+		return configError(err, "error unmarshaling mysql")
 	}
 
 	// unmarshall docker config
-	err = viper.UnmarshalKey("docker_config", &dockerConfig)
-	if err != nil {
-		fmt.Printf("Error unmarshaling docker_config: %s", err.Error())
-		os.Exit(1)
+	if err := viper.UnmarshalKey("docker_config", &dockerConfig); err != nil {
+		return configError(err, "error unmarshaling docker_config")
+	}
+
+	if err := checkProjectName(); err != nil {
+		return err
 	}
 
-	teleportHost = viper.GetString("teleport_host")
+	// teleport_host is the old name of teleport.host.
+	if teleportConfig.Host == "" {
+		teleportConfig.Host = viper.GetString("teleport_host")
+	}
+	return nil
+}
 
-	// Set the global progress spinner
-	progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
+// checkConfigLoaded fails a command when upctl.yaml could not be loaded. validate,
+// doctor and version run anyway; the first two report configuration problems themselves.
+func checkConfigLoaded(cmd *cobra.Command, args []string) error {
+	if cmd == validateCmd || cmd == doctorCmd || cmd == versionCmd {
+		return nil
+	}
+	return configLoadErr
 }
 
 // versionCmd represents the version command
@@ -551,5 +578,7 @@ var versionCmd = &cobra.Command{
 }
 
 func StopProgress() {
-	progress.Stop()
+	if progress != nil {
+		progress.Stop()
+	}
 }
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Runtime runs the services of the rendered compose project. It hides which
+// container engine is used so that commands don't build engine specific argument lists.
+type Runtime interface {
+	// Name returns the name the runtime is selected by.
+	Name() string
+	// Start creates and starts the given services, or all services when none are given.
+	Start(services []string) error
+	// Remove stops and removes the containers of the given services only.
+	Remove(services []string) error
+	// Down tears down the whole project, including its volumes when volumes is set.
+	Down(volumes bool) error
+	// Status returns the containers of the given services, or of all services when none are given.
+	// Stopped and exited containers are included.
+	Status(services []string) ([]DockerPsJSONEntry, error)
+	// Logs streams the logs of the given services, or of all services when none are given.
+	Logs(services []string, follow bool) error
+	// LogTail returns the last lines of the logs of a service.
+	LogTail(service string, lines int) (string, error)
+	// Exec runs a command inside the container of a service, streaming input.Stdin to it
+	// and its output to input.Stdout.
+	// The variables in input.Env are set in the container without their values
+	// appearing in any argument list.
+	Exec(service string, command []string, input CommandIO) error
+	// CopyIn copies a local file into the container of a service.
+	CopyIn(service string, src string, dst string) error
+	// ContainerID returns the ID of the container running a service.
+	ContainerID(service string) (string, error)
+}
+
+// composeRuntime drives a 'docker compose' compatible CLI.
+type composeRuntime struct {
+	name        string
+	command     string
+	prefix      []string
+	composeFile string
+}
+
+// composeRuntimes lists the supported runtimes and how their compose CLI is invoked.
+var composeRuntimes = map[string]composeRuntime{
+	"docker":         {name: "docker", command: "docker", prefix: []string{"compose"}},
+	"podman":         {name: "podman", command: "podman", prefix: []string{"compose"}},
+	"podman-compose": {name: "podman-compose", command: "podman-compose"},
+	"nerdctl":        {name: "nerdctl", command: "nerdctl", prefix: []string{"compose"}},
+}
+
+// defaultRuntimeName is used when neither --runtime nor the 'runtime' config key is set.
+const defaultRuntimeName = "docker"
+
+// runtimeName returns the runtime selected by --runtime or the 'runtime' key in upctl.yaml.
+func runtimeName() string {
+	if name := viper.GetString("runtime"); name != "" {
+		return name
+	}
+	return defaultRuntimeName
+}
+
+// newRuntime returns the runtime for the compose file. Tests replace it to plug in a fake runtime.
+var newRuntime = func(composeFile string) (Runtime, error) {
+	name := runtimeName()
+	rt, ok := composeRuntimes[name]
+	if !ok {
+		names := make([]string, 0, len(composeRuntimes))
+		for n := range composeRuntimes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, configError(nil, "unknown runtime '%s', expected one of: %s", name, strings.Join(names, ", "))
+	}
+	rt.composeFile = composeFile
+	return &rt, nil
+}
+
+// projectRuntime renders the compose file and returns the selected runtime for it.
+func projectRuntime() (Runtime, error) {
+	composePath, err := writeComposeFile()
+	if err != nil {
+		return nil, err
+	}
+	return newRuntime(composePath)
+}
+
+func (r *composeRuntime) Name() string {
+	return r.name
+}
+
+// args returns the compose arguments for a sub-command, e.g. "compose -f <file> up".
+func (r *composeRuntime) args(subcommand ...string) []string {
+	args := append([]string{}, r.prefix...)
+	args = append(args, "-f", r.composeFile)
+	return append(args, subcommand...)
+}
+
+func (r *composeRuntime) Start(services []string) error {
+	return ExecuteCommand(r.command, append(r.args("up", "-d"), services...)...)
+}
+
+func (r *composeRuntime) Remove(services []string) error {
+	return ExecuteCommand(r.command, append(r.args("rm", "--stop", "--force"), services...)...)
+}
+
+func (r *composeRuntime) Down(volumes bool) error {
+	args := r.args("down")
+	if volumes {
+		args = append(args, "--volumes")
+	}
+	return ExecuteCommand(r.command, args...)
+}
+
+func (r *composeRuntime) Status(services []string) ([]DockerPsJSONEntry, error) {
+	args := append(r.args("ps"), services...)
+	args = append(args, "--format", "json", "--all")
+	output, err := CaptureCommand(r.command, args...)
+	// Parse whatever was printed even on failure; callers decide how to report the error.
+	return parsePsOutput(output), err
+}
+
+func (r *composeRuntime) Logs(services []string, follow bool) error {
+	args := r.args("logs")
+	if follow {
+		args = append(args, "--follow")
+	}
+	return ExecuteCommand(r.command, append(args, services...)...)
+}
+
+func (r *composeRuntime) LogTail(service string, lines int) (string, error) {
+	return CaptureCommand(r.command, r.args("logs", "--no-color", "--tail", strconv.Itoa(lines), service)...)
+}
+
+func (r *composeRuntime) Exec(service string, command []string, input CommandIO) error {
+	args := r.args("exec", "-T")
+	for _, env := range input.Env {
+		// '-e NAME' without a value makes the compose CLI copy NAME from its own environment.
+		name, _, _ := strings.Cut(env, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, service)
+	return StreamCommand(input, r.command, append(args, command...)...)
+}
+
+func (r *composeRuntime) CopyIn(service string, src string, dst string) error {
+	return ExecuteCommand(r.command, r.args("cp", src, service+":"+dst)...)
+}
+
+func (r *composeRuntime) ContainerID(service string) (string, error) {
+	output, err := CaptureCommand(r.command, r.args("ps", "-q", service)...)
+	if err != nil {
+		return "", err
+	}
+	containerID := strings.TrimSpace(output)
+	if containerID == "" {
+		return "", fmt.Errorf("no running container found for service '%s'", service)
+	}
+	// Only the first container is used when a service is scaled.
+	if idx := strings.IndexByte(containerID, '\n'); idx >= 0 {
+		containerID = containerID[:idx]
+	}
+	return containerID, nil
+}
+
+// parsePsOutput parses the JSON lines printed by 'compose ps --format json'.
+// Some compose versions print a single JSON array instead, which is accepted too.
+func parsePsOutput(output string) []DockerPsJSONEntry {
+	var entries []DockerPsJSONEntry
+	trimmed := strings.TrimSpace(output)
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not parse JSON from 'compose ps': %v\n", err)
+		}
+		return entries
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry DockerPsJSONEntry
+		if errUnmarshal := json.Unmarshal([]byte(line), &entry); errUnmarshal != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not parse JSON line from 'compose ps': %v\nLine: %s\n", errUnmarshal, line)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if errScan := scanner.Err(); errScan != nil {
+		fmt.Fprintf(os.Stderr, "Error reading 'compose ps' output stream: %v\n", errScan)
+	}
+	return entries
+}
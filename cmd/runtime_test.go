@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// fakeRuntime records the calls made to it instead of running a container engine.
+type fakeRuntime struct {
+	mu       sync.Mutex
+	calls    []string
+	services [][]string
+	status   []DockerPsJSONEntry
+	err      error
+	// statusSeq, when set, is returned by successive Status calls; the last one repeats.
+	statusSeq [][]DockerPsJSONEntry
+	logs      string
+	// stdin collects what was streamed to Exec.
+	stdin []byte
+	// execOutput is written to the Stdout of Exec calls that capture it.
+	execOutput string
+	// execFailOn makes Exec fail when what is streamed to it contains this text.
+	execFailOn string
+}
+
+func (f *fakeRuntime) record(call string, services []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	f.services = append(f.services, services)
+	return f.err
+}
+
+func (f *fakeRuntime) Name() string { return "fake" }
+func (f *fakeRuntime) Start(services []string) error {
+	return f.record("start", services)
+}
+func (f *fakeRuntime) Remove(services []string) error {
+	return f.record("remove", services)
+}
+func (f *fakeRuntime) Down(volumes bool) error {
+	if volumes {
+		return f.record("down", []string{"--volumes"})
+	}
+	return f.record("down", nil)
+}
+func (f *fakeRuntime) Status(services []string) ([]DockerPsJSONEntry, error) {
+	if len(f.statusSeq) > 0 {
+		f.status = f.statusSeq[0]
+		if len(f.statusSeq) > 1 {
+			f.statusSeq = f.statusSeq[1:]
+		}
+	}
+	return f.status, f.record("status", services)
+}
+func (f *fakeRuntime) LogTail(service string, lines int) (string, error) {
+	return f.logs, f.record("logtail", []string{service})
+}
+func (f *fakeRuntime) Logs(services []string, follow bool) error {
+	return f.record("logs", services)
+}
+func (f *fakeRuntime) Exec(service string, command []string, input CommandIO) error {
+	if input.Stdin != nil {
+		data, err := io.ReadAll(input.Stdin)
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.stdin = append(f.stdin, data...)
+		f.mu.Unlock()
+		if f.execFailOn != "" && strings.Contains(string(data), f.execFailOn) {
+			f.record("exec", append([]string{service}, command...))
+			return errors.New("exit status 1")
+		}
+	}
+	if input.Stdout != nil {
+		if _, err := io.WriteString(input.Stdout, f.execOutput); err != nil {
+			return err
+		}
+	}
+	return f.record("exec", append([]string{service}, command...))
+}
+func (f *fakeRuntime) CopyIn(service string, src string, dst string) error {
+	return f.record("copy", []string{service, src, dst})
+}
+func (f *fakeRuntime) ContainerID(service string) (string, error) {
+	return "container-" + service, f.record("container", []string{service})
+}
+
+// useFakeRuntime makes projectRuntime return rt for the rest of the test.
+func useFakeRuntime(t *testing.T, rt *fakeRuntime) {
+	original := newRuntime
+	newRuntime = func(string) (Runtime, error) { return rt, nil }
+	t.Cleanup(func() { newRuntime = original })
+}
+
+func TestNewRuntime_Selection(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		runtime        string
+		expectedBinary string
+		expectedArgs   []string
+	}{
+		{"", "docker", []string{"compose", "-f", "/state/docker-compose.yml", "up", "-d", "web"}},
+		{"podman", "podman", []string{"compose", "-f", "/state/docker-compose.yml", "up", "-d", "web"}},
+		{"podman-compose", "podman-compose", []string{"-f", "/state/docker-compose.yml", "up", "-d", "web"}},
+		{"nerdctl", "nerdctl", []string{"compose", "-f", "/state/docker-compose.yml", "up", "-d", "web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			viper.Set("runtime", tt.runtime)
+			rt, err := newRuntime("/state/docker-compose.yml")
+			if err != nil {
+				t.Fatalf("newRuntime() returned an error: %v", err)
+			}
+
+			originalExecuteCommand := ExecuteCommand
+			ExecuteCommand = mockExecuteCommandVolumes
+			mockExecuteTracker = []MockExecuteCommand{}
+			defer func() { ExecuteCommand = originalExecuteCommand }()
+
+			if err := rt.Start([]string{"web"}); err != nil {
+				t.Fatalf("Start() returned an error: %v", err)
+			}
+			call := mockExecuteTracker[0]
+			if call.Command != tt.expectedBinary || !equalSlices(call.Args, tt.expectedArgs) {
+				t.Errorf("Expected %s %v, got %s %v", tt.expectedBinary, tt.expectedArgs, call.Command, call.Args)
+			}
+		})
+	}
+
+	viper.Set("runtime", "containerd")
+	if _, err := newRuntime("/state/docker-compose.yml"); err == nil || !strings.Contains(err.Error(), "unknown runtime 'containerd'") {
+		t.Errorf("Expected unknown runtime error, got %v", err)
+	}
+}
+
+func TestParsePsOutput_ArrayFormat(t *testing.T) {
+	entries := parsePsOutput(`[{"Service":"web","State":"running"},{"Service":"db","State":"exited","ExitCode":1}]`)
+	if len(entries) != 2 || entries[0].Service != "web" || entries[1].ExitCode != 1 {
+		t.Errorf("Unexpected entries parsed from array output: %+v", entries)
+	}
+}
+
+func TestRunDockerComposeUp_FakeRuntime(t *testing.T) {
+	setup(t)
+	defer teardown()
+	rt := &fakeRuntime{}
+	useFakeRuntime(t, rt)
+
+	testRootCmd, _ := InitializeTestCmd(t)
+	if _, err := executeCommandCobra(testRootCmd, "up", "service1"); err != nil {
+		t.Fatalf("up service1 failed: %v", err)
+	}
+
+	if len(rt.calls) != 1 || rt.calls[0] != "start" || !equalSlices(rt.services[0], []string{"service1"}) {
+		t.Errorf("Expected one start call for service1, got calls %v with services %v", rt.calls, rt.services)
+	}
+	if mockExecuteCmdInfo.Calls != 0 {
+		t.Errorf("ExecuteCommand should not be called when a fake runtime is used, was called %d times", mockExecuteCmdInfo.Calls)
+	}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prefixes of secret references in configuration values.
+const (
+	keyringSecretPrefix = "secret://keyring/"
+	fileSecretPrefix    = "secret://file/"
+	commandSecretPrefix = "cmd://"
+)
+
+// secretEnvPrefix names the variables that carry resolved secrets to Docker Compose.
+const secretEnvPrefix = "UPCTL_SECRET_"
+
+// defaultSecretsFile is the name of the encrypted secrets file in ~/.upctl.
+const defaultSecretsFile = "secrets.yaml.gpg"
+
+// isSecretReference reports whether a configuration value refers to a secret.
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, keyringSecretPrefix) ||
+		strings.HasPrefix(value, fileSecretPrefix) ||
+		strings.HasPrefix(value, commandSecretPrefix)
+}
+
+// secretResolver resolves secret references, each reference once.
+type secretResolver struct {
+	// file is the encrypted secrets file used by secret://file/ references.
+	file string
+	// fileSecrets holds the decrypted secrets file once it has been read.
+	fileSecrets map[string]string
+	resolved    map[string]string
+}
+
+// resolve returns the value a secret reference points to.
+func (r *secretResolver) resolve(ref string) (string, error) {
+	if value, ok := r.resolved[ref]; ok {
+		return value, nil
+	}
+	var value string
+	var err error
+	switch {
+	case strings.HasPrefix(ref, keyringSecretPrefix):
+		value, err = keyringSecret(strings.TrimPrefix(ref, keyringSecretPrefix))
+	case strings.HasPrefix(ref, fileSecretPrefix):
+		value, err = r.fileSecret(strings.TrimPrefix(ref, fileSecretPrefix))
+	case strings.HasPrefix(ref, commandSecretPrefix):
+		value, err = firstLine(CaptureCommand("sh", "-c", strings.TrimPrefix(ref, commandSecretPrefix)))
+	}
+	if err != nil {
+		return "", err
+	}
+	if r.resolved == nil {
+		r.resolved = make(map[string]string)
+	}
+	r.resolved[ref] = value
+	return value, nil
+}
+
+// keyringSecret reads '<service>/<account>' from the OS keyring: the Secret Service
+// through secret-tool on Linux and the login keychain through security on macOS.
+func keyringSecret(path string) (string, error) {
+	service, account, ok := strings.Cut(path, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("expected secret://keyring/<service>/<account>")
+	}
+	var tool string
+	var args []string
+	switch runtime.GOOS {
+	case "linux":
+		tool, args = "secret-tool", []string{"lookup", "service", service, "account", account}
+	case "darwin":
+		tool, args = "security", []string{"find-generic-password", "-s", service, "-a", account, "-w"}
+	default:
+		return "", fmt.Errorf("the keyring is not supported on %s", runtime.GOOS)
+	}
+	bin, err := lookPath(tool)
+	if err != nil {
+		return "", err
+	}
+	output, err := CaptureCommand(bin, args...)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(output, "\n")
+	if value == "" {
+		return "", fmt.Errorf("no secret found for service '%s' and account '%s'", service, account)
+	}
+	return value, nil
+}
+
+// fileSecret returns a key of the encrypted secrets file, a YAML mapping of names to
+// values encrypted with gpg. The file is decrypted once, in memory.
+func (r *secretResolver) fileSecret(name string) (string, error) {
+	if r.fileSecrets == nil {
+		gpg, err := lookPath("gpg")
+		if err != nil {
+			return "", err
+		}
+		output, err := CaptureCommand(gpg, "--quiet", "--batch", "--decrypt", r.file)
+		if err != nil {
+			return "", fmt.Errorf("error decrypting '%s': %w", r.file, err)
+		}
+		secrets := make(map[string]string)
+		if err := yaml.Unmarshal([]byte(output), &secrets); err != nil {
+			return "", fmt.Errorf("error parsing '%s': it must map names to values", r.file)
+		}
+		r.fileSecrets = secrets
+	}
+	value, ok := r.fileSecrets[name]
+	if !ok {
+		return "", fmt.Errorf("'%s' is not in '%s'", name, r.file)
+	}
+	return value, nil
+}
+
+// secretsFile returns the encrypted secrets file: secrets.file, or
+// ~/.upctl/secrets.yaml.gpg.
+func secretsFile(config map[string]interface{}) (string, error) {
+	if section, ok := config["secrets"].(map[string]interface{}); ok {
+		if file, ok := section["file"].(string); ok && file != "" {
+			return cleanPath(file)
+		}
+	}
+	home, err := upctlHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, defaultSecretsFile), nil
+}
+
+// secretEnvName returns the variable that carries the secret of a reference to
+// Docker Compose. It is derived from the reference, so the rendered compose file
+// doesn't change from one run to the next.
+func secretEnvName(ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return secretEnvPrefix + strings.ToUpper(hex.EncodeToString(sum[:6]))
+}
+
+// secretWalker replaces the secret references in the configuration.
+type secretWalker struct {
+	resolver *secretResolver
+	// placeholders replaces secrets with ${UPCTL_SECRET_...} variables set in the
+	// environment of upctl instead of their values. Services, volumes and networks
+	// get rendered into a compose file on disk, so their secrets only reach Docker
+	// Compose this way.
+	placeholders bool
+	failed       []string
+}
+
+// config replaces the secret references in a configuration value; key is its path.
+// Items of environment lists, NAME=<reference>, are resolved too.
+func (w *secretWalker) config(value interface{}, key string) interface{} {
+	switch v := value.(type) {
+	case string:
+		prefix, ref := "", v
+		if name, rest, ok := strings.Cut(v, "="); ok && !isSecretReference(v) && !strings.ContainsAny(name, " \t") {
+			prefix, ref = name+"=", rest
+		}
+		if !isSecretReference(ref) {
+			return v
+		}
+		secret, err := w.resolver.resolve(ref)
+		if err != nil {
+			w.failed = append(w.failed, fmt.Sprintf("%s in %s: %v", ref, key, err))
+			return v
+		}
+		if !w.placeholders {
+			return prefix + secret
+		}
+		name := secretEnvName(ref)
+		if err := os.Setenv(name, secret); err != nil {
+			w.failed = append(w.failed, fmt.Sprintf("%s in %s: %v", ref, key, err))
+			return v
+		}
+		return prefix + "${" + name + "}"
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = w.config(item, key+"."+k)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = w.config(item, fmt.Sprintf("%s[%d]", key, i))
+		}
+	}
+	return value
+}
+
+// resolveSecrets replaces the secret references in the merged configuration:
+//
+//	secret://keyring/<service>/<account>  the OS keyring
+//	secret://file/<name>                  the gpg encrypted secrets file
+//	cmd://<command>                       the first line printed by a shell command
+//
+// Resolved secrets are only kept in memory. In the sections rendered into the
+// compose file they are replaced with variables that Docker Compose reads from its
+// environment, so they are never written to it.
+func resolveSecrets(config map[string]interface{}) error {
+	file, err := secretsFile(config)
+	if err != nil {
+		return err
+	}
+	resolver := &secretResolver{file: file}
+	var failed []string
+	for key, value := range config {
+		w := &secretWalker{resolver: resolver, placeholders: composeSections[key]}
+		config[key] = w.config(value, key)
+		failed = append(failed, w.failed...)
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("unresolved secrets in the configuration:\n  %s", strings.Join(failed, "\n  "))
+	}
+	return nil
+}
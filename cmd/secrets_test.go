@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mockSecretStores answers the keyring, gpg and pass lookups with fixed secrets and
+// counts how often each store is asked.
+func mockSecretStores(t *testing.T) map[string]int {
+	t.Helper()
+	fakeTools(t, "secret-tool", "security", "gpg")
+	original := CaptureCommand
+	t.Cleanup(func() { CaptureCommand = original })
+	calls := make(map[string]int)
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		name := filepath.Base(command)
+		calls[name]++
+		joined := strings.Join(args, " ")
+		switch {
+		case name == "secret-tool" && joined == "lookup service upctl account mysql",
+			name == "security" && joined == "find-generic-password -s upctl -a mysql -w":
+			return "keyring-secret\n", nil
+		case name == "gpg":
+			return "registry: file-secret\n", nil
+		case name == "sh" && joined == "-c pass show upctl/grafana":
+			return "pass-secret\nurl: https://grafana.example.com\n", nil
+		}
+		return "", fmt.Errorf("exit status 1")
+	}
+	return calls
+}
+
+func TestResolveSecrets(t *testing.T) {
+	calls := mockSecretStores(t)
+	t.Setenv("UPCTL_HOME", t.TempDir())
+	for _, ref := range []string{"secret://keyring/upctl/mysql", "cmd://pass show upctl/grafana"} {
+		t.Setenv(secretEnvName(ref), "") // restored when the test ends
+	}
+
+	config := map[string]interface{}{
+		"mysql":         map[string]interface{}{"user": "root", "password": "secret://keyring/upctl/mysql"},
+		"docker_config": map[string]interface{}{"password": "secret://file/registry"},
+		"services": map[string]interface{}{
+			"grafana": map[string]interface{}{
+				"environment": []interface{}{"GF_SECURITY_ADMIN_USER=admin", "GF_SECURITY_ADMIN_PASSWORD=cmd://pass show upctl/grafana"},
+			},
+			"mysql": map[string]interface{}{
+				"environment": map[string]interface{}{"MYSQL_ROOT_PASSWORD": "secret://keyring/upctl/mysql"},
+			},
+		},
+	}
+	if err := resolveSecrets(config); err != nil {
+		t.Fatalf("resolveSecrets() returned an error: %v", err)
+	}
+
+	if got := config["mysql"].(map[string]interface{})["password"]; got != "keyring-secret" {
+		t.Errorf("Expected mysql.password from the keyring, got %v", got)
+	}
+	if got := config["docker_config"].(map[string]interface{})["password"]; got != "file-secret" {
+		t.Errorf("Expected docker_config.password from the secrets file, got %v", got)
+	}
+
+	services := config["services"].(map[string]interface{})
+	grafanaEnv := services["grafana"].(map[string]interface{})["environment"].([]interface{})
+	passRef := "cmd://pass show upctl/grafana"
+	if want := "GF_SECURITY_ADMIN_PASSWORD=${" + secretEnvName(passRef) + "}"; grafanaEnv[1] != want {
+		t.Errorf("Expected %q in the grafana environment, got %v", want, grafanaEnv[1])
+	}
+	if grafanaEnv[0] != "GF_SECURITY_ADMIN_USER=admin" {
+		t.Errorf("Expected plain values to be kept, got %v", grafanaEnv[0])
+	}
+	if got := os.Getenv(secretEnvName(passRef)); got != "pass-secret" {
+		t.Errorf("Expected the first line printed by pass in %s, got %q", secretEnvName(passRef), got)
+	}
+	mysqlEnv := services["mysql"].(map[string]interface{})["environment"].(map[string]interface{})
+	keyringRef := "secret://keyring/upctl/mysql"
+	if want := "${" + secretEnvName(keyringRef) + "}"; mysqlEnv["MYSQL_ROOT_PASSWORD"] != want {
+		t.Errorf("Expected %q for MYSQL_ROOT_PASSWORD, got %v", want, mysqlEnv["MYSQL_ROOT_PASSWORD"])
+	}
+
+	if calls["secret-tool"]+calls["security"] != 1 {
+		t.Errorf("Expected a reference used twice to be looked up once, got %v", calls)
+	}
+}
+
+func TestResolveSecrets_ListsFailures(t *testing.T) {
+	mockSecretStores(t)
+	t.Setenv("UPCTL_HOME", t.TempDir())
+	config := map[string]interface{}{
+		"mysql":         map[string]interface{}{"password": "secret://keyring/upctl/unknown"},
+		"docker_config": map[string]interface{}{"password": "secret://file/missing"},
+		"teleport":      map[string]interface{}{"aws_role": "cmd://false"},
+		"repositories":  []interface{}{map[string]interface{}{"password": "secret://keyring/no-account"}},
+	}
+	err := resolveSecrets(config)
+	if err == nil {
+		t.Fatal("Expected an error for unresolved secrets")
+	}
+	for _, want := range []string{
+		"secret://keyring/upctl/unknown in mysql.password",
+		"secret://file/missing in docker_config.password: 'missing' is not in",
+		"cmd://false in teleport.aws_role",
+		"secret://keyring/no-account in repositories[0].password: expected secret://keyring/<service>/<account>",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in the error, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "file-secret") {
+		t.Errorf("Expected the error not to reveal secrets, got:\n%v", err)
+	}
+}
+
+func TestWriteComposeFile_KeepsSecretsOut(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mockSecretStores(t)
+	t.Setenv("HOME", t.TempDir())
+	project := t.TempDir()
+	chdir(t, project)
+	ref := "secret://keyring/upctl/mysql"
+	t.Setenv(secretEnvName(ref), "")
+
+	writeConfigFile(t, "upctl.yaml", `
+services:
+  mysql:
+    image: mysql:8.0
+    environment:
+      - MYSQL_ROOT_PASSWORD=secret://keyring/upctl/mysql
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	path, err := writeComposeFile()
+	if err != nil {
+		t.Fatalf("writeComposeFile() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the compose file: %v", err)
+	}
+	if strings.Contains(string(data), "keyring-secret") {
+		t.Errorf("Expected the secret to stay out of the compose file, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "MYSQL_ROOT_PASSWORD=${"+secretEnvName(ref)+"}") {
+		t.Errorf("Expected a variable in place of the secret, got:\n%s", data)
+	}
+}
+
+func TestWriteComposeFile_KeepsVolumeSecretsOut(t *testing.T) {
+	setup(t)
+	defer teardown()
+	mockSecretStores(t)
+	t.Setenv("HOME", t.TempDir())
+	chdir(t, t.TempDir())
+	ref := "secret://keyring/upctl/mysql"
+	t.Setenv(secretEnvName(ref), "")
+
+	writeConfigFile(t, "upctl.yaml", `
+services:
+  app:
+    image: app:1.0
+    volumes: ["share:/data"]
+volumes:
+  share:
+    driver: vieux/sshfs
+    driver_opts:
+      sshcmd: app@fileserver:/share
+      password: secret://keyring/upctl/mysql
+`)
+	if err := readConfig(""); err != nil {
+		t.Fatalf("readConfig() returned an error: %v", err)
+	}
+	path, err := writeComposeFile()
+	if err != nil {
+		t.Fatalf("writeComposeFile() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the compose file: %v", err)
+	}
+	if strings.Contains(string(data), "keyring-secret") {
+		t.Errorf("Expected the volume secret to stay out of the compose file, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "password: ${"+secretEnvName(ref)+"}") {
+		t.Errorf("Expected a variable in place of the volume secret, got:\n%s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the compose file to be readable by its owner only, got %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/viper"
+)
+
+// defaultProjectName is the Compose project name used when upctl.yaml does not set one.
+const defaultProjectName = "upctl"
+
+// upctlHomeDir returns the directory upctl keeps its own files in.
+// It defaults to ~/.upctl and can be moved with the UPCTL_HOME environment variable.
+func upctlHomeDir() (string, error) {
+	if dir := os.Getenv("UPCTL_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user's home directory: %w", err)
+	}
+	return filepath.Join(home, ".upctl"), nil
+}
+
+// projectName returns the Compose project name configured in upctl.yaml.
+func projectName() string {
+	if name := viper.GetString("project"); name != "" {
+		return name
+	}
+	return defaultProjectName
+}
+
+// projectNamePattern matches the project names Docker Compose accepts, which are
+// also safe to use as a directory name.
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// checkProjectName fails when the configured project name is not a valid Docker
+// Compose project name, which also keeps it from pointing outside of ~/.upctl
+// when it is used as a directory name.
+func checkProjectName() error {
+	name := projectName()
+	if !projectNamePattern.MatchString(name) {
+		return configError(nil, "invalid project name '%s': use lowercase letters, digits, '_' and '-', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// projectStateDir returns the state directory of the current project, creating it if needed.
+func projectStateDir() (string, error) {
+	if err := checkProjectName(); err != nil {
+		return "", err
+	}
+	home, err := upctlHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, "state", projectName())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating state directory '%s': %s", dir, err)
+	}
+	return dir, nil
+}
+
+// writeFileIfChanged writes data to path unless the file already holds exactly that content,
+// in which case only its permissions are set to perm. It reports whether the file was written.
+func writeFileIfChanged(path string, data []byte, perm os.FileMode) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() != perm {
+			return false, os.Chmod(path, perm)
+		}
+		return false, nil
+	}
+
+	// Write to a sibling file first so a concurrent upctl never sees a half written file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return false, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// teleportRenewMargin renews a Teleport session or app certificate this long before
+// it expires, so that it doesn't run out halfway through a command.
+const teleportRenewMargin = 5 * time.Minute
+
+// TeleportStatus is the active Teleport session as reported by 'tsh status'.
+type TeleportStatus struct {
+	ProfileURL string    `json:"profile_url"`
+	Username   string    `json:"username"`
+	Cluster    string    `json:"cluster"`
+	Roles      []string  `json:"roles"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// proxyHost returns the hostname of the proxy the session belongs to.
+func (s TeleportStatus) proxyHost() string {
+	u, err := url.Parse(s.ProfileURL)
+	if err != nil || u.Host == "" {
+		return hostOnly(s.ProfileURL)
+	}
+	return u.Hostname()
+}
+
+// hostOnly strips the port from a host[:port] address.
+func hostOnly(address string) string {
+	host, _, _ := strings.Cut(address, ":")
+	return host
+}
+
+// tshNoSessionMessages are the messages 'tsh status' fails with when there is no
+// session to use, as opposed to failures such as an unreadable profile.
+var tshNoSessionMessages = []string{"not logged in", "profile expired"}
+
+// teleportStatus returns the active Teleport session, or nil when there is none.
+func teleportStatus(tsh string) (*TeleportStatus, error) {
+	output, err := CaptureCommand(tsh, "status", "--format=json")
+	if err != nil {
+		message := strings.ToLower(output + err.Error())
+		for _, noSession := range tshNoSessionMessages {
+			if strings.Contains(message, noSession) {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+	var status struct {
+		Active *TeleportStatus `json:"active"`
+	}
+	if err := json.Unmarshal([]byte(output), &status); err != nil {
+		return nil, fmt.Errorf("error parsing 'tsh status' output: %w", err)
+	}
+	return status.Active, nil
+}
+
+// appCertExpiry returns when the certificate of a Teleport app login expires, or an
+// error when the app is not logged into.
+func appCertExpiry(tsh, app string) (time.Time, error) {
+	output, err := CaptureCommand(tsh, "apps", "config", app, "--format=json")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not logged into app '%s'", app)
+	}
+	var config struct {
+		Cert string `json:"cert"`
+	}
+	if err := json.Unmarshal([]byte(output), &config); err != nil || config.Cert == "" {
+		return time.Time{}, fmt.Errorf("no certificate found for app '%s'", app)
+	}
+	data, err := os.ReadFile(config.Cert)
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("certificate '%s' is not PEM encoded", config.Cert)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// teleportSession makes sure the Teleport session and app certificates a command
+// needs are valid. Sessions and certificates that are still valid are reused; only
+// missing or expiring ones are renewed, and each is checked once per session.
+type teleportSession struct {
+	loggedIn bool
+	apps     map[string]bool
+}
+
+// login makes sure there is a valid session with the proxy in teleport.host.
+func (s *teleportSession) login() error {
+	if s.loggedIn {
+		return nil
+	}
+	if teleportConfig.Host == "" {
+		return configError(nil, "teleport.host is not set")
+	}
+	tsh, err := lookPath("tsh")
+	if err != nil {
+		return err
+	}
+	status, err := teleportStatus(tsh)
+	if err != nil {
+		return toolError(err, "error checking the Teleport session")
+	}
+	if status == nil || status.proxyHost() != hostOnly(teleportConfig.Host) || time.Now().Add(teleportRenewMargin).After(status.ValidUntil) {
+		fmt.Println("Authenticating with Teleport...")
+		if err := ExecuteCommand(tsh, "login", fmt.Sprintf("--proxy=%s", teleportConfig.Host)); err != nil {
+			return toolError(err, "error authenticating with Teleport")
+		}
+	}
+	s.loggedIn = true
+	return nil
+}
+
+// app makes sure there is a valid certificate for a Teleport app, logging in with
+// teleport.aws_role when there isn't.
+func (s *teleportSession) app(name string) error {
+	if s.apps[name] {
+		return nil
+	}
+	if err := s.login(); err != nil {
+		return err
+	}
+	tsh, err := lookPath("tsh")
+	if err != nil {
+		return err
+	}
+	expiry, err := appCertExpiry(tsh, name)
+	if err != nil || time.Now().Add(teleportRenewMargin).After(expiry) {
+		fmt.Printf("Authenticating with AWS App: %s...\n", name)
+		if err := ExecuteCommand(tsh, "apps", "login", name, "--aws-role", teleportConfig.AWSRole); err != nil {
+			return toolError(err, "error authenticating with AWS app '%s'", name)
+		}
+	}
+	if s.apps == nil {
+		s.apps = make(map[string]bool)
+	}
+	s.apps[name] = true
+	return nil
+}
+
+// teleportApps returns the Teleport apps the configuration uses: teleport.aws_app
+// and the apps of registries logged into through Teleport.
+func teleportApps() []string {
+	seen := make(map[string]bool)
+	var apps []string
+	add := func(app string) {
+		if app != "" && !seen[app] {
+			seen[app] = true
+			apps = append(apps, app)
+		}
+	}
+	add(teleportConfig.AWSApp)
+	if registries, err := loadRegistries(dockerConfig); err == nil {
+		for _, reg := range registries {
+			if reg.Auth == authTeleportECR {
+				add(reg.AWSApp)
+			}
+		}
+	}
+	return apps
+}
+
+// RunLogin logs into Teleport and every app the configuration uses, reusing the
+// session and certificates that are still valid.
+func RunLogin(cmd *cobra.Command, args []string) error {
+	session := &teleportSession{}
+	if err := session.login(); err != nil {
+		return err
+	}
+	for _, app := range teleportApps() {
+		if err := session.app(app); err != nil {
+			return err
+		}
+	}
+	return RunWhoami(cmd, args)
+}
+
+// RunLogout logs out of the Teleport apps and the Teleport session.
+func RunLogout(cmd *cobra.Command, args []string) error {
+	tsh, err := lookPath("tsh")
+	if err != nil {
+		return err
+	}
+	for _, app := range teleportApps() {
+		// An app that is not logged into can't be logged out of, which is no
+		// reason to keep the Teleport session, so this only warns.
+		if err := ExecuteCommand(tsh, "apps", "logout", app); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not log out of app %s: %s\n", app, err)
+		}
+	}
+	if err := ExecuteCommand(tsh, "logout"); err != nil {
+		return toolError(err, "error logging out of Teleport")
+	}
+	fmt.Println("Logged out of Teleport")
+	return nil
+}
+
+// RunWhoami prints the Teleport session and the validity of the app certificates.
+func RunWhoami(cmd *cobra.Command, args []string) error {
+	tsh, err := lookPath("tsh")
+	if err != nil {
+		return err
+	}
+	status, err := teleportStatus(tsh)
+	if err != nil {
+		return toolError(err, "error checking the Teleport session")
+	}
+	if status == nil {
+		fmt.Println("Not logged into Teleport; run 'upctl login'")
+		return nil
+	}
+	roles := append([]string(nil), status.Roles...)
+	sort.Strings(roles)
+	fmt.Printf("User:        %s\n", status.Username)
+	fmt.Printf("Proxy:       %s\n", status.proxyHost())
+	fmt.Printf("Cluster:     %s\n", status.Cluster)
+	fmt.Printf("Roles:       %s\n", strings.Join(roles, ", "))
+	fmt.Printf("Valid until: %s\n", describeExpiry(status.ValidUntil))
+	for _, app := range teleportApps() {
+		expiry, err := appCertExpiry(tsh, app)
+		if err != nil {
+			fmt.Printf("App %s: not logged in\n", app)
+			continue
+		}
+		fmt.Printf("App %s: valid until %s\n", app, describeExpiry(expiry))
+	}
+	return nil
+}
+
+// describeExpiry formats an expiry time with how long is left, or that it passed.
+func describeExpiry(t time.Time) string {
+	left := time.Until(t).Round(time.Minute)
+	if left <= 0 {
+		return fmt.Sprintf("%s (expired)", t.Local().Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("%s (%s left)", t.Local().Format("2006-01-02 15:04"), left)
+}
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log into Teleport and the apps upctl uses",
+	Long:  `Logs into the Teleport proxy in teleport.host and the apps in teleport.aws_app and docker_config. A session or app certificate that is still valid is reused instead of logging in again.`,
+	Args:  cobra.NoArgs,
+	RunE:  RunLogin,
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Log out of Teleport and its apps",
+	Args:  cobra.NoArgs,
+	RunE:  RunLogout,
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the Teleport session and app certificates",
+	Args:  cobra.NoArgs,
+	RunE:  RunWhoami,
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a PEM certificate valid until notAfter and returns its path.
+func writeTestCert(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app"},
+		NotBefore:    notAfter.Add(-12 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "app.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	return path
+}
+
+// mockTeleport answers 'tsh status' with a session valid until sessionValid, or no
+// session when it is zero, and 'tsh apps config' with the certificates in certs.
+// Other captured commands go to the CaptureCommand in place before.
+func mockTeleport(t *testing.T, proxy string, sessionValid time.Time, certs map[string]string) {
+	original := CaptureCommand
+	t.Cleanup(func() { CaptureCommand = original })
+	CaptureCommand = func(command string, args ...string) (string, error) {
+		if !strings.HasSuffix(command, "tsh") || len(args) == 0 {
+			return original(command, args...)
+		}
+		switch {
+		case args[0] == "status":
+			mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+			if sessionValid.IsZero() {
+				return "", fmt.Errorf("command failed: exit status 1\nStderr: ERROR: Not logged in.")
+			}
+			return fmt.Sprintf(`{"active": {"profile_url": "https://%s:443", "username": "alice", "cluster": "main", "roles": ["dev", "access"], "valid_until": %q}}`,
+				proxy, sessionValid.Format(time.RFC3339)), nil
+		case len(args) > 2 && args[0] == "apps" && args[1] == "config":
+			mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+			cert, ok := certs[args[2]]
+			if !ok {
+				return "", fmt.Errorf("not logged into app")
+			}
+			return fmt.Sprintf(`{"name": %q, "cert": %q}`, args[2], cert), nil
+		}
+		return original(command, args...)
+	}
+}
+
+// tshLogins returns the tsh login commands that were run.
+func tshLogins() []string {
+	var logins []string
+	for _, call := range mockExecuteTracker {
+		args := strings.Join(call.Args, " ")
+		if strings.HasSuffix(call.Command, "tsh") && (strings.HasPrefix(args, "login") || strings.HasPrefix(args, "apps login")) {
+			logins = append(logins, args)
+		}
+	}
+	return logins
+}
+
+func TestTeleportSession(t *testing.T) {
+	originalTeleport := teleportConfig
+	defer func() { teleportConfig = originalTeleport }()
+	teleportConfig = TeleportConfig{Host: "teleport.example.com:443", AWSApp: "aws", AWSRole: "dev"}
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		proxy        string
+		sessionValid time.Time
+		certValid    time.Time
+		wantLogins   []string
+	}{
+		{name: "valid session and certificate are reused", proxy: "teleport.example.com", sessionValid: now.Add(8 * time.Hour), certValid: now.Add(time.Hour)},
+		{name: "no session", sessionValid: time.Time{}, certValid: now.Add(time.Hour),
+			wantLogins: []string{"login --proxy=teleport.example.com:443"}},
+		{name: "session of another proxy", proxy: "other.example.com", sessionValid: now.Add(8 * time.Hour), certValid: now.Add(time.Hour),
+			wantLogins: []string{"login --proxy=teleport.example.com:443"}},
+		{name: "expiring certificate only", proxy: "teleport.example.com", sessionValid: now.Add(8 * time.Hour), certValid: now.Add(time.Minute),
+			wantLogins: []string{"apps login aws --aws-role dev"}},
+		{name: "no certificate", proxy: "teleport.example.com", sessionValid: now.Add(8 * time.Hour),
+			wantLogins: []string{"apps login aws --aws-role dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeTools(t, "tsh")
+			recordAllCommands(t)
+			certs := map[string]string{}
+			if !tt.certValid.IsZero() {
+				certs["aws"] = writeTestCert(t, tt.certValid)
+			}
+			mockTeleport(t, tt.proxy, tt.sessionValid, certs)
+
+			session := &teleportSession{}
+			for i := 0; i < 2; i++ {
+				if err := session.app("aws"); err != nil {
+					t.Fatalf("app() returned an error: %v", err)
+				}
+			}
+			if got := tshLogins(); !equalSlices(got, tt.wantLogins) {
+				t.Errorf("Expected logins %v, got %v", tt.wantLogins, got)
+			}
+		})
+	}
+}
+
+func TestRunWhoami(t *testing.T) {
+	fakeTools(t, "tsh")
+	recordAllCommands(t)
+	originalTeleport, originalDocker := teleportConfig, dockerConfig
+	defer func() { teleportConfig, dockerConfig = originalTeleport, originalDocker }()
+	teleportConfig = TeleportConfig{Host: "teleport.example.com", AWSApp: "aws"}
+	dockerConfig = DockerConfig{Registries: []RegistryConfig{{Name: "ecr", Registry: "1.dkr.ecr.eu-west-1.amazonaws.com", Auth: authTeleportECR, AWSApp: "ecr"}}}
+	mockTeleport(t, "teleport.example.com", time.Now().Add(8*time.Hour), map[string]string{"aws": writeTestCert(t, time.Now().Add(time.Hour))})
+
+	output := captureOutput(func() {
+		if err := RunWhoami(whoamiCmd, nil); err != nil {
+			t.Fatalf("RunWhoami() returned an error: %v", err)
+		}
+	})
+	for _, want := range []string{"User:        alice", "Proxy:       teleport.example.com", "Roles:       access, dev", "App aws: valid until", "App ecr: not logged in"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in the output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestTeleportStatus_Failures(t *testing.T) {
+	originalCapture := CaptureCommand
+	defer func() { CaptureCommand = originalCapture }()
+
+	tests := []struct {
+		name    string
+		stderr  string
+		wantErr bool
+	}{
+		{name: "not logged in", stderr: "ERROR: Not logged in."},
+		{name: "expired profile", stderr: "ERROR: Active profile expired."},
+		{name: "unreadable profile", stderr: "ERROR: open /home/alice/.tsh/teleport.example.com.yaml: permission denied", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			CaptureCommand = func(command string, args ...string) (string, error) {
+				return "", fmt.Errorf("command failed: exit status 1\nStderr: %s", tt.stderr)
+			}
+			status, err := teleportStatus("tsh")
+			if status != nil {
+				t.Errorf("Expected no session, got %+v", status)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected an error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunLogout_WarnsWhenAppLogoutFails(t *testing.T) {
+	fakeTools(t, "tsh")
+	recordAllCommands(t)
+	originalTeleport, originalDocker := teleportConfig, dockerConfig
+	defer func() { teleportConfig, dockerConfig = originalTeleport, originalDocker }()
+	teleportConfig = TeleportConfig{Host: "teleport.example.com", AWSApp: "aws"}
+	dockerConfig = DockerConfig{}
+	ExecuteCommand = func(command string, args ...string) error {
+		mockExecuteTracker = append(mockExecuteTracker, MockExecuteCommand{Command: command, Args: args})
+		if len(args) > 1 && args[0] == "apps" && args[1] == "logout" {
+			return fmt.Errorf("exit status 1")
+		}
+		return nil
+	}
+
+	originalStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	err := RunLogout(logoutCmd, nil)
+	w.Close()
+	os.Stderr = originalStderr
+	stderr, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("RunLogout() returned an error: %v", err)
+	}
+	if !strings.Contains(string(stderr), "Warning: could not log out of app aws") {
+		t.Errorf("Expected a warning about the app logout, got %q", stderr)
+	}
+	last := mockExecuteTracker[len(mockExecuteTracker)-1]
+	if !strings.HasSuffix(last.Command, "tsh") || !equalSlices(last.Args, []string{"logout"}) {
+		t.Errorf("Expected 'tsh logout' to run anyway, got %s %v", last.Command, last.Args)
+	}
+}
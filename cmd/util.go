@@ -4,7 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,29 +13,29 @@ import (
 
 // cleanPath cleans up a path and expands ~ to the user's home directory
 // if it is present. It then converts the path to an absolute path.
-func cleanPath(path string) string {
+func cleanPath(path string) (string, error) {
 	cleanedPath := filepath.Clean(path)
 
 	// check backward and forward paths for Windows
 	if strings.HasPrefix(cleanedPath, "~/") || strings.HasPrefix(cleanedPath, "~\\") {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			log.Fatalf("Error getting user's home directory: %s", err)
+			return "", fmt.Errorf("error getting user's home directory: %w", err)
 		}
 		expandedPath := filepath.Join(homeDir, cleanedPath[2:])
 		cleanedPath = expandedPath
 	}
 
 	if strings.HasPrefix(cleanedPath, "/tmp") || strings.HasPrefix(cleanedPath, "\\tmp") {
-		expandedPath := filepath.Join(os.TempDir(), cleanedPath[2:])
+		expandedPath := filepath.Join(os.TempDir(), cleanedPath[len("/tmp"):])
 		cleanedPath = expandedPath
 	}
 
 	absPath, err := filepath.Abs(cleanedPath)
 	if err != nil {
-		log.Fatalf("Error converting to absolute path: %s", err)
+		return "", fmt.Errorf("error converting to absolute path: %w", err)
 	}
-	return absPath
+	return absPath, nil
 }
 
 // ExecuteCommandResult represents the result of executing a CLI command.
@@ -113,27 +113,62 @@ var CaptureCommand = func(command string, args ...string) (string, error) {
 
 	if err != nil {
 		// Include stderr in the error message if the command failed
-		return stdoutBuf.String(), fmt.Errorf("command failed: %s\nStderr: %s", err, stderrBuf.String())
+		return stdoutBuf.String(), fmt.Errorf("command failed: %w\nStderr: %s", err, stderrBuf.String())
 	}
 
 	return stdoutBuf.String(), nil
 }
 
-// tshAwsEcrLogin
-func tshAwsEcrLogin() (string, error) {
-	cmd := exec.Command("tsh", "aws", "--app", dockerConfig.AWSApp, "ecr", "get-login-password", "--region", "eu-west-1")
+// CommandIO is the input and output of a command run with StreamCommand.
+type CommandIO struct {
+	// Stdin is streamed to the command's standard input when set.
+	Stdin io.Reader
+	// Stdout receives the command's standard output instead of the console when set.
+	Stdout io.Writer
+	// Env holds extra NAME=value environment variables. Secrets are passed this way
+	// or through Stdin so that they never show up in the process list.
+	Env []string
+}
+
+// StreamCommand executes the given CLI command with its standard input connected to
+// input.Stdin. Output goes straight to the console, or to input.Stdout, so that long
+// running commands such as a database import show their messages as they happen.
+var StreamCommand = func(input CommandIO, command string, args ...string) error {
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = input.Stdin
+	if len(input.Env) > 0 {
+		cmd.Env = append(os.Environ(), input.Env...)
+	}
+	cmd.Stdout = os.Stdout
+	if input.Stdout != nil {
+		cmd.Stdout = input.Stdout
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
 
-	var outBuf, errBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &errBuf
+// tshAwsEcrLogin returns a Docker login password for ECR in region through the Teleport AWS app.
+func tshAwsEcrLogin(app, region string) (string, error) {
+	return firstLine(CaptureCommand("tsh", "aws", "--app", app, "ecr", "get-login-password", "--region", region))
+}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("error executing command: %v, stderr: %s", err, errBuf.String())
+// awsEcrLogin returns a Docker login password for ECR in region through the aws CLI,
+// using profile when it is set.
+func awsEcrLogin(profile, region string) (string, error) {
+	args := []string{"ecr", "get-login-password", "--region", region}
+	if profile != "" {
+		args = append(args, "--profile", profile)
 	}
+	return firstLine(CaptureCommand("aws", args...))
+}
 
-	scanner := bufio.NewScanner(&outBuf)
-	for scanner.Scan() {
-		return scanner.Text(), nil
+// firstLine returns the first line of a command's output, failing when it is empty.
+func firstLine(output string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if line := strings.TrimSpace(strings.SplitN(output, "\n", 2)[0]); line != "" {
+		return line, nil
 	}
 	return "", fmt.Errorf("no password found")
 }
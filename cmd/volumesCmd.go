@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -18,7 +17,7 @@ var volumesLsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List Docker volumes",
 	Long:  `Lists all Docker volumes. Equivalent to 'docker volume ls'.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if progress == nil {
 			// Initialize progress spinner if not already (e.g. if called directly)
 			// This is a basic initialization, consider using the one from root.go if more complex setup is needed
@@ -28,11 +27,10 @@ var volumesLsCmd = &cobra.Command{
 		// defer progress.Stop()
 
 		fmt.Println("Listing Docker volumes...")
-		err := ExecuteCommand("docker", "volume", "ls")
-		if err != nil {
-			fmt.Printf("Error listing Docker volumes: %s\n", err.Error())
-			os.Exit(1)
+		if err := ExecuteCommand("docker", "volume", "ls"); err != nil {
+			return toolError(err, "error listing Docker volumes")
 		}
+		return nil
 	},
 }
 
@@ -41,7 +39,7 @@ var volumesRmCmd = &cobra.Command{
 	Short: "Remove Docker volumes",
 	Long:  `Removes one or more specified Docker volumes. Equivalent to 'docker volume rm <volume_name>'.`,
 	Args:  cobra.MinimumNArgs(1), // Require at least one volume name
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if progress == nil {
 			// Basic initialization, see comment in lsCmd
 			// progress = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
@@ -51,13 +49,12 @@ var volumesRmCmd = &cobra.Command{
 
 		fmt.Printf("Removing Docker volume(s): %s\n", strings.Join(args, ", "))
 		dockerArgs := append([]string{"volume", "rm"}, args...)
-		err := ExecuteCommand("docker", dockerArgs...)
-		if err != nil {
-			fmt.Printf("Error removing Docker volumes: %s\n", err.Error())
-			// os.Exit(1) // Decide if failure to remove one volume should stop everything or report and continue
-		} else {
-			fmt.Println("Successfully removed volume(s):", strings.Join(args, ", "))
+		if err := ExecuteCommand("docker", dockerArgs...); err != nil {
+			// docker removes the volumes it can and reports the rest, so the error covers only those.
+			return toolError(err, "error removing Docker volumes")
 		}
+		fmt.Println("Successfully removed volume(s):", strings.Join(args, ", "))
+		return nil
 	},
 }
 
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -13,6 +14,9 @@ type MockExecuteCommand struct {
 	Command string
 	Args    []string
 	Err     error
+	// Stdin and Env are what a StreamCommand call received.
+	Stdin string
+	Env   []string
 }
 
 var mockExecuteTracker []MockExecuteCommand
@@ -25,6 +29,20 @@ func mockExecuteCommandVolumes(command string, args ...string) error {
 	return nil // Default to no error
 }
 
+// mockStreamCommand replaces the real StreamCommand for testing, reading stdin to the end.
+func mockStreamCommand(input CommandIO, command string, args ...string) error {
+	tracker := MockExecuteCommand{Command: command, Args: args, Env: input.Env}
+	if input.Stdin != nil {
+		data, err := io.ReadAll(input.Stdin)
+		if err != nil {
+			return err
+		}
+		tracker.Stdin = string(data)
+	}
+	mockExecuteTracker = append(mockExecuteTracker, tracker)
+	return nil
+}
+
 // mockCaptureCommand replaces the real CaptureCommand for testing
 func mockCaptureCommand(command string, args ...string) (string, error) {
 	tracker := MockExecuteCommand{Command: command, Args: args}
@@ -49,7 +67,7 @@ func TestVolumesLsCmd(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	volumesLsCmd.Run(volumesLsCmd, []string{})
+	volumesLsCmd.RunE(volumesLsCmd, []string{})
 
 	w.Close()
 	os.Stdout = oldStdout // Restore stdout
@@ -105,9 +123,8 @@ func TestVolumesRmCmd(t *testing.T) {
 			r, w, _ := os.Pipe()
 			os.Stdout = w
 
-			// volumesRmCmd.Run checks Args, so we call it directly
-			// If volumesRmCmd used RunE, we'd call Execute() on it or its parent.
-			volumesRmCmd.Run(volumesRmCmd, tt.args)
+			// Args are validated by cobra before RunE, so we call RunE directly
+			volumesRmCmd.RunE(volumesRmCmd, tt.args)
 
 			w.Close()
 			os.Stdout = oldStdout
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultWaitTimeout is how long 'up --wait' and 'install --wait' wait for services by default.
+const defaultWaitTimeout = 5 * time.Minute
+
+// waitLogLines is the number of log lines shown for a service that failed to become ready.
+const waitLogLines = 20
+
+// waitPollInterval is the time between two status checks while waiting. Tests shorten it.
+var waitPollInterval = 2 * time.Second
+
+// Readiness of a service while waiting for it.
+const (
+	serviceWaiting = iota
+	serviceReady
+	serviceFailed
+)
+
+// serviceReadiness classifies a 'compose ps' entry. A service is ready when its
+// container runs and is healthy, or has no healthcheck and was already running at
+// the previous check, whose description is previous: a crashing container can be
+// caught while it is briefly up. A container that exited with code 0 is a completed
+// one-off task and counts as ready too; one that is restarting has crashed. The
+// returned description is shown as progress and in errors.
+func serviceReadiness(entry DockerPsJSONEntry, found bool, previous string) (int, string) {
+	if !found {
+		return serviceWaiting, "not created"
+	}
+	state := strings.ToLower(entry.State)
+	health := strings.ToLower(entry.Health)
+	switch state {
+	case "running":
+		switch health {
+		case "":
+			if previous == "running" {
+				return serviceReady, "running"
+			}
+			return serviceWaiting, "running"
+		case "healthy":
+			return serviceReady, "healthy"
+		case "unhealthy":
+			return serviceFailed, "unhealthy"
+		default:
+			return serviceWaiting, "running (health: " + health + ")"
+		}
+	case "exited", "dead":
+		if entry.ExitCode == 0 && state == "exited" {
+			return serviceReady, "completed"
+		}
+		return serviceFailed, fmt.Sprintf("%s with code %d", state, entry.ExitCode)
+	case "restarting":
+		return serviceFailed, fmt.Sprintf("restarting after exiting with code %d", entry.ExitCode)
+	case "":
+		return serviceWaiting, "unknown"
+	default:
+		return serviceWaiting, state
+	}
+}
+
+// waitFlags returns the values of the --wait and --timeout flags of cmd.
+func waitFlags(cmd *cobra.Command) (bool, time.Duration) {
+	wait, _ := cmd.Flags().GetBool("wait")
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		timeout = defaultWaitTimeout
+	}
+	return wait, timeout
+}
+
+// addWaitFlags adds the --wait and --timeout flags to a command that starts services.
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("wait", false, "Wait until the services are running and healthy")
+	cmd.Flags().Duration("timeout", defaultWaitTimeout, "Maximum time to wait with --wait, e.g. 90s or 5m")
+}
+
+// waitForServices polls the status of the given services, or of all configured
+// services when none are given, until every one of them is ready. Progress is
+// printed whenever a service changes state. It fails as soon as a service becomes
+// unhealthy, exits with an error or restarts, or when the timeout expires, and
+// prints the last log lines of each service that is not ready.
+func waitForServices(rt Runtime, services []string, timeout time.Duration) error {
+	if len(services) == 0 {
+		for name := range dockerComposeConfig.Services {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Waiting up to %s for %s...\n", timeout, strings.Join(services, ", "))
+	deadline := time.Now().Add(timeout)
+	last := make(map[string]string, len(services))
+	for {
+		entries, err := rt.Status(services)
+		if err != nil && len(entries) == 0 {
+			return toolError(err, "error checking the status of services")
+		}
+		byService := make(map[string]DockerPsJSONEntry, len(entries))
+		for _, entry := range entries {
+			byService[entry.Service] = entry
+		}
+
+		var pending, failed []string
+		for _, service := range services {
+			entry, found := byService[service]
+			readiness, description := serviceReadiness(entry, found, last[service])
+			if last[service] != description {
+				fmt.Printf("  %s: %s\n", service, description)
+				last[service] = description
+			}
+			switch readiness {
+			case serviceFailed:
+				failed = append(failed, service)
+			case serviceWaiting:
+				pending = append(pending, service)
+			}
+		}
+
+		if len(failed) > 0 {
+			printServiceLogTails(rt, failed)
+			return &Error{Kind: KindToolFailed, Msg: "service(s) failed to become ready: " + describeServices(failed, last)}
+		}
+		if len(pending) == 0 {
+			fmt.Println("All services are ready")
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			printServiceLogTails(rt, pending)
+			return &Error{Kind: KindToolFailed, Msg: fmt.Sprintf("timed out after %s waiting for: %s", timeout, describeServices(pending, last))}
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// describeServices formats services with their last known state, e.g. "mysql (unhealthy)".
+func describeServices(services []string, states map[string]string) string {
+	described := make([]string, len(services))
+	for i, service := range services {
+		described[i] = fmt.Sprintf("%s (%s)", service, states[service])
+	}
+	return strings.Join(described, ", ")
+}
+
+// printServiceLogTails prints the last log lines of each service to stderr.
+func printServiceLogTails(rt Runtime, services []string) {
+	for _, service := range services {
+		output, err := rt.LogTail(service, waitLogLines)
+		fmt.Fprintf(os.Stderr, "--- last %d log lines of %s ---\n", waitLogLines, service)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "(could not read logs: %s)\n", err)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, strings.TrimRight(output, "\n"))
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func useShortWaitPollInterval(t *testing.T) {
+	original := waitPollInterval
+	waitPollInterval = time.Millisecond
+	t.Cleanup(func() { waitPollInterval = original })
+}
+
+func TestServiceReadiness(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     DockerPsJSONEntry
+		found     bool
+		previous  string
+		readiness int
+	}{
+		{"not created", DockerPsJSONEntry{}, false, "", serviceWaiting},
+		{"just running without healthcheck", DockerPsJSONEntry{State: "running"}, true, "created", serviceWaiting},
+		{"still running without healthcheck", DockerPsJSONEntry{State: "running"}, true, "running", serviceReady},
+		{"health starting", DockerPsJSONEntry{State: "running", Health: "starting"}, true, "", serviceWaiting},
+		{"healthy", DockerPsJSONEntry{State: "running", Health: "healthy"}, true, "", serviceReady},
+		{"unhealthy", DockerPsJSONEntry{State: "running", Health: "unhealthy"}, true, "", serviceFailed},
+		{"restarting", DockerPsJSONEntry{State: "restarting", ExitCode: 1}, true, "running", serviceFailed},
+		{"completed", DockerPsJSONEntry{State: "exited", ExitCode: 0}, true, "", serviceReady},
+		{"crashed", DockerPsJSONEntry{State: "exited", ExitCode: 137}, true, "", serviceFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if readiness, description := serviceReadiness(tt.entry, tt.found, tt.previous); readiness != tt.readiness {
+				t.Errorf("Expected readiness %d, got %d (%s)", tt.readiness, readiness, description)
+			}
+		})
+	}
+}
+
+func TestRunDockerComposeUp_WaitUntilHealthy(t *testing.T) {
+	setup(t)
+	defer teardown()
+	useShortWaitPollInterval(t)
+	rt := &fakeRuntime{statusSeq: [][]DockerPsJSONEntry{
+		{{Service: "service1", State: "running", Health: "starting"}},
+		{{Service: "service1", State: "running", Health: "healthy"}},
+	}}
+	useFakeRuntime(t, rt)
+
+	testRootCmd, _ := InitializeTestCmd(t)
+	if _, err := executeCommandCobra(testRootCmd, "up", "service1", "--wait", "--timeout", "5s"); err != nil {
+		t.Fatalf("up --wait failed: %v", err)
+	}
+	expected := []string{"start", "status", "status"}
+	if !equalSlices(rt.calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, rt.calls)
+	}
+}
+
+func TestRunDockerComposeUp_WaitFailsOnExit(t *testing.T) {
+	setup(t)
+	defer teardown()
+	useShortWaitPollInterval(t)
+	rt := &fakeRuntime{
+		status: []DockerPsJSONEntry{{Service: "service1", State: "exited", ExitCode: 1}},
+		logs:   "fatal: could not bind port\n",
+	}
+	useFakeRuntime(t, rt)
+
+	testRootCmd, _ := InitializeTestCmd(t)
+	_, err := executeCommandCobra(testRootCmd, "up", "service1", "--wait")
+	if err == nil || !strings.Contains(err.Error(), "service1 (exited with code 1)") {
+		t.Fatalf("Expected a failure for the exited service, got %v", err)
+	}
+	if ExitCode(err) != ExitToolFailed {
+		t.Errorf("Expected exit code %d, got %d", ExitToolFailed, ExitCode(err))
+	}
+	if rt.calls[len(rt.calls)-1] != "logtail" {
+		t.Errorf("Expected the logs of the failed service to be read, got calls %v", rt.calls)
+	}
+}
+
+func TestWaitForServices_Timeout(t *testing.T) {
+	useShortWaitPollInterval(t)
+	rt := &fakeRuntime{status: []DockerPsJSONEntry{{Service: "mysql", State: "running", Health: "starting"}}}
+
+	err := waitForServices(rt, []string{"mysql"}, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), "mysql (running (health: starting))") {
+		t.Fatalf("Expected a timeout error naming mysql, got %v", err)
+	}
+}
+
+func TestWaitForServices_CrashLoop(t *testing.T) {
+	useShortWaitPollInterval(t)
+	rt := &fakeRuntime{
+		statusSeq: [][]DockerPsJSONEntry{
+			{{Service: "api", State: "running"}},
+			{{Service: "api", State: "restarting", ExitCode: 2}},
+		},
+		logs: "panic: missing DATABASE_URL\n",
+	}
+
+	err := waitForServices(rt, []string{"api"}, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "api (restarting after exiting with code 2)") {
+		t.Fatalf("Expected a crash-looping service to fail, got %v", err)
+	}
+	if rt.calls[len(rt.calls)-1] != "logtail" {
+		t.Errorf("Expected the logs of the failed service to be read, got calls %v", rt.calls)
+	}
+}
@@ -12,7 +12,9 @@ func main() {
 
 	go catchSignal()
 
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(cmd.ExitCode(err))
+	}
 }
 
 func catchSignal() {
@@ -26,7 +28,13 @@ func catchSignal() {
 		case s := <-terminateSignals:
 			fmt.Println("Got one of stop signals, shutting down, SIGNAL NAME :", s)
 			cmd.StopProgress()
-			os.Exit(0)
+			cmd.RunInterruptCleanups()
+			// Exit like a shell does for a process killed by a signal: 128 + signal number.
+			code := 1
+			if sig, ok := s.(syscall.Signal); ok {
+				code = 128 + int(sig)
+			}
+			os.Exit(code)
 			break //break is not necessary to add here as if server is closed our main function will end.
 		}
 	}